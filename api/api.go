@@ -5,8 +5,10 @@ import (
 	"altrinity/api/middleware"
 	"altrinity/api/repositories"
 	"altrinity/api/services"
+	"context"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -39,7 +41,7 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"https://app.altrinitytech.com", "http://localhost:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type"},
+		AllowHeaders:     []string{"Origin", "Authorization", "Content-Type", "Last-Event-ID"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -65,9 +67,117 @@ func main() {
 		Addr: os.Getenv("REDIS_ADDR"), // e.g. localhost:6379
 	})
 
+	geofenceRepo := &repositories.GeofenceRepository{DB: db, Redis: redisClient}
+	geofenceService := &services.GeofenceService{
+		Repo:         geofenceRepo,
+		BufferMeters: envFloat("GEOFENCE_BUFFER_METERS", services.DefaultGeofenceBuffer),
+		Dwell:        envDuration("GEOFENCE_DWELL", services.DefaultGeofenceDwell),
+	}
+	go geofenceService.Run(context.Background())
+	geofenceController := &controllers.GeofenceController{Service: geofenceService}
+
+	areaRepo := &repositories.AreaRepository{DB: db}
+	settingsService := &services.SettingsService{
+		Repo:  &repositories.SettingsRepository{DB: db},
+		Areas: areaRepo,
+		Defaults: services.PositionThresholds{
+			MinDistanceMeters: envFloat("POSITION_MIN_DISTANCE_METERS", services.DefaultMinDistanceMeters),
+			MinUpdateInterval: envDuration("POSITION_MIN_UPDATE_INTERVAL", services.DefaultMinUpdateInterval),
+			LiveTTL:           envDuration("POSITION_LIVE_TTL", services.DefaultLiveTTL),
+		},
+	}
+	go settingsService.Run(context.Background())
+	settingsController := &controllers.SettingsController{Service: settingsService}
+
+	presenceService := &services.PresenceService{
+		Repo:         &repositories.PresenceRepository{Redis: redisClient},
+		IdleAfter:    envDuration("PRESENCE_IDLE_AFTER", services.DefaultPresenceIdleAfter),
+		StaleAfter:   envDuration("PRESENCE_STALE_AFTER", services.DefaultPresenceStaleAfter),
+		OfflineAfter: envDuration("PRESENCE_OFFLINE_AFTER", services.DefaultPresenceOfflineAfter),
+	}
+	go presenceService.Run(context.Background())
+
 	volRepo := &repositories.VolunteerRepository{DB: db, Redis: redisClient}
-	volService := &services.VolunteerService{Repo: volRepo}
-	volController := &controllers.VolunteerController{Service: volService}
+	canvassRepo := &repositories.CanvassRepository{DB: db}
+	shiftService := &services.ShiftService{
+		Repo:       &repositories.ShiftRepository{DB: db, Redis: redisClient},
+		Areas:      areaRepo,
+		Volunteers: volRepo,
+		Canvass:    canvassRepo,
+	}
+	shiftController := &controllers.ShiftController{Service: shiftService}
+	privacyService := &services.PrivacyService{
+		Repo:       &repositories.PrivacyRepository{DB: db, Redis: redisClient},
+		Volunteers: volRepo,
+	}
+	privacyController := &controllers.PrivacyController{Service: privacyService}
+	volService := &services.VolunteerService{
+		Repo:              volRepo,
+		Geofence:          geofenceService,
+		MaxAccuracyMeters: envFloat("POSITION_MAX_ACCURACY_METERS", services.DefaultMaxAccuracyMeters),
+		MaxSpeed:          envFloat("POSITION_MAX_SPEED_KMH", services.DefaultMaxSpeedKmh) / 3.6,
+		Settings:          settingsService,
+		Presence:          presenceService,
+		Shifts:            shiftService,
+		RequireShift:      envBool("POSITION_REQUIRE_SHIFT", true),
+		Privacy:           privacyService,
+	}
+
+	areaService := &services.AreaService{Repo: areaRepo}
+	streamService := &services.StreamService{Volunteers: volRepo, Areas: areaRepo, Presence: presenceService}
+	volController := &controllers.VolunteerController{Service: volService, Stream: streamService}
+	go streamService.Run(context.Background()) // one feed reader per instance for all stream clients
+	areaController := &controllers.AreaController{Service: areaService}
+
+	stopRepo := &repositories.StopRepository{DB: db}
+	stopService := &services.StopService{Repo: stopRepo, Areas: areaRepo}
+	stopController := &controllers.StopController{Service: stopService}
+	importController := &controllers.ImportController{Service: &services.ImportService{Areas: areaService, Stops: stopService}}
+	turfService := &services.TurfService{Repo: &repositories.TurfRepository{DB: db}, Areas: areaRepo, Stops: stopRepo}
+	turfController := &controllers.TurfController{Service: turfService}
+	exportController := &controllers.ExportController{Service: &services.ExportService{Repo: &repositories.ExportRepository{DB: db}}}
+
+	assignRepo := &repositories.AssignmentRepository{DB: db, Redis: redisClient}
+	assignHub := &services.ChannelHub{Redis: redisClient, Pattern: repositories.AssignmentChannel("*")}
+	go assignHub.Run(context.Background())
+	routeService := &services.RouteService{Assignments: assignRepo, Volunteers: volRepo}
+	routeController := &controllers.RouteController{Service: routeService}
+	assignService := &services.AssignmentService{Repo: assignRepo, Stops: stopRepo, Volunteers: volRepo, Hub: assignHub, Routes: routeService}
+	assignController := &controllers.AssignmentController{Service: assignService}
+
+	dispatchService := &services.DispatchService{
+		Assignments: assignService,
+		AssignRepo:  assignRepo,
+		Stops:       stopRepo,
+		Turfs:       turfService.Repo,
+		Shifts:      shiftService.Repo,
+		Volunteers:  volRepo,
+		Capacity:    envInt("DISPATCH_CAPACITY", services.DefaultDispatchCapacity),
+		Interval:    envDuration("DISPATCH_INTERVAL", 0),
+	}
+	go dispatchService.Run(context.Background())
+	dispatchController := &controllers.DispatchController{Service: dispatchService}
+
+	canvassService := &services.CanvassService{Repo: canvassRepo, Areas: areaRepo, Routes: routeService}
+	canvassController := &controllers.CanvassController{Service: canvassService}
+
+	retentionService := &services.RetentionService{
+		Repo:             &repositories.RetentionRepository{DB: db, Redis: redisClient},
+		RawFor:           envDuration("RETENTION_RAW", services.DefaultRetentionRaw),
+		DownsampledFor:   envDuration("RETENTION_DOWNSAMPLED", services.DefaultRetentionDownsampled),
+		DownsampleBucket: envDuration("RETENTION_DOWNSAMPLE_BUCKET", services.DefaultDownsampleBucket),
+		Interval:         envDuration("RETENTION_INTERVAL", services.DefaultRetentionInterval),
+	}
+	go retentionService.Run(context.Background())
+	retentionController := &controllers.RetentionController{Service: retentionService}
+
+	sosService := &services.SOSService{
+		Repo:             &repositories.SOSRepository{DB: db, Redis: redisClient},
+		Volunteers:       volRepo,
+		ReminderInterval: envDuration("SOS_REMINDER_INTERVAL", services.DefaultSOSReminderInterval),
+	}
+	go sosService.Run(context.Background())
+	sosController := &controllers.SOSController{Service: sosService}
 
 	api := r.Group("/api")
 	{
@@ -83,9 +193,103 @@ func main() {
 			c.JSON(200, gin.H{"msg": "hello admin"})
 		})
 		api.POST("/positions", middleware.AuthMiddleware("volunteer"), volController.UpdatePosition)
+		api.POST("/positions/batch", middleware.AuthMiddleware("volunteer"), volController.UploadPositions)
 		api.GET("/positions", middleware.AuthMiddleware("admin"), volController.GetPositions)
+		api.GET("/positions/flagged", middleware.AuthMiddleware("admin"), volController.GetFlagged)
 		api.GET("/ws/positions", volController.StreamPositions)
+		api.GET("/sse/positions", middleware.AuthMiddleware("admin"), volController.StreamPositionsSSE)
+		api.GET("/streams/stats", middleware.AuthMiddleware("admin"), func(c *gin.Context) {
+			c.JSON(200, gin.H{"positions": streamService.Metrics.Stats(), "assignments": assignHub.Metrics.Stats()})
+		})
+		api.POST("/shifts/check-in", middleware.AuthMiddleware("volunteer"), shiftController.CheckIn)
+		api.POST("/shifts/check-out", middleware.AuthMiddleware("volunteer"), shiftController.CheckOut)
+		api.GET("/me/shift", middleware.AuthMiddleware("volunteer"), shiftController.CurrentShift)
+		api.GET("/me/privacy", middleware.AuthMiddleware("volunteer"), privacyController.GetMine)
+		api.PUT("/me/privacy", middleware.AuthMiddleware("volunteer"), privacyController.UpdateMine)
+		api.GET("/privacy", middleware.AuthMiddleware("admin"), privacyController.ListRestricted)
+		api.GET("/shifts", middleware.AuthMiddleware("admin"), shiftController.ListShifts)
+		api.GET("/shifts/totals", middleware.AuthMiddleware("admin"), shiftController.ShiftTotals)
+		api.GET("/volunteers/:id/track", middleware.AuthMiddleware("admin"), volController.GetTrack)
+		api.DELETE("/volunteers/:id/locations", middleware.AuthMiddleware("admin"), retentionController.PurgeVolunteer)
+		api.GET("/retention", middleware.AuthMiddleware("admin"), retentionController.GetPolicy)
+		api.POST("/sos", middleware.AuthMiddleware("volunteer"), sosController.Raise)
+		api.GET("/sos", middleware.AuthMiddleware("admin"), sosController.ListIncidents)
+		api.GET("/sos/:id", middleware.AuthMiddleware("admin"), sosController.GetIncident)
+		api.POST("/sos/:id/acknowledge", middleware.AuthMiddleware("admin"), sosController.Acknowledge)
+		api.POST("/sos/:id/resolve", middleware.AuthMiddleware("admin"), sosController.Resolve)
+		api.POST("/sos/:id/notes", middleware.AuthMiddleware("admin"), sosController.AddNote)
+		api.GET("/alerts/geofence", middleware.AuthMiddleware("admin"), geofenceController.ListAlerts)
+
+		api.GET("/settings/positions", middleware.AuthMiddleware("admin"), settingsController.GetPositionSettings)
+		api.PUT("/settings/positions", middleware.AuthMiddleware("admin"), settingsController.UpdatePositionSettings)
+		api.DELETE("/settings/positions", middleware.AuthMiddleware("admin"), settingsController.ResetPositionSettings)
+		api.PUT("/areas/:id/settings/positions", middleware.AuthMiddleware("admin"), settingsController.UpdateAreaPositionSettings)
+		api.DELETE("/areas/:id/settings/positions", middleware.AuthMiddleware("admin"), settingsController.ResetAreaPositionSettings)
+
+		api.GET("/areas", middleware.AuthMiddleware("admin"), areaController.ListAreas)
+		api.POST("/areas", middleware.AuthMiddleware("admin"), areaController.CreateArea)
+		api.POST("/areas/import", middleware.AuthMiddleware("admin"), importController.ImportAreas)
+		api.GET("/areas/:id", middleware.AuthMiddleware("admin"), areaController.GetArea)
+		api.PUT("/areas/:id", middleware.AuthMiddleware("admin"), areaController.UpdateArea)
+		api.DELETE("/areas/:id", middleware.AuthMiddleware("admin"), areaController.DeleteArea)
+
+		api.GET("/areas/:id/stops", middleware.AuthMiddleware("admin"), stopController.ListStops)
+		api.POST("/areas/:id/stops", middleware.AuthMiddleware("admin"), stopController.CreateStop)
+		api.POST("/areas/:id/stops/bulk", middleware.AuthMiddleware("admin"), stopController.BulkCreateStops)
+		api.POST("/areas/:id/stops/import", middleware.AuthMiddleware("admin"), importController.ImportStops)
+		api.DELETE("/areas/:id/stops/:stopId", middleware.AuthMiddleware("admin"), stopController.DeleteStop)
+		api.GET("/areas/:id/turfs", middleware.AuthMiddleware("admin"), turfController.ListTurfs)
+		api.POST("/areas/:id/turfs", middleware.AuthMiddleware("admin"), turfController.Cut)
+
+		api.GET("/assignments", middleware.AuthMiddleware("admin"), assignController.ListAssignments)
+		api.POST("/assignments", middleware.AuthMiddleware("admin"), assignController.Assign)
+		api.POST("/assignments/unassign", middleware.AuthMiddleware("admin"), assignController.Unassign)
+		api.POST("/assignments/reassign", middleware.AuthMiddleware("admin"), assignController.Reassign)
+		api.GET("/me/assignments", middleware.AuthMiddleware("volunteer"), assignController.MyAssignments)
+		api.GET("/ws/assignments", assignController.StreamAssignments)
+		api.POST("/dispatch/preview", middleware.AuthMiddleware("admin"), dispatchController.Preview)
+		api.POST("/dispatch/commit", middleware.AuthMiddleware("admin"), dispatchController.Commit)
+
+		api.GET("/export/:dataset", middleware.AuthMiddleware("admin"), exportController.Export)
+		api.GET("/me/route", middleware.AuthMiddleware("volunteer"), routeController.MyRoute)
+		api.GET("/volunteers/:id/route", middleware.AuthMiddleware("admin"), routeController.VolunteerRoute)
+
+		api.POST("/stops/:id/results", middleware.AuthMiddleware("volunteer"), canvassController.RecordResult)
+		api.GET("/areas/:id/results/summary", middleware.AuthMiddleware("admin"), canvassController.AreaSummary)
+		api.GET("/volunteers/:id/results/summary", middleware.AuthMiddleware("admin"), canvassController.VolunteerSummary)
 	}
 
 	r.Run("0.0.0.0:8081")
 }
+
+// envFloat reads a float from the environment, falling back to def if unset or malformed.
+func envFloat(key string, def float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
+	}
+	return def
+}
+
+// envInt reads an integer from the environment, falling back to def if unset or malformed.
+func envInt(key string, def int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envDuration reads a Go duration (e.g. "90s") from the environment, falling back to def.
+func envDuration(key string, def time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
+
+// envBool reads a boolean (1/0, true/false) from the environment, falling back to def.
+func envBool(key string, def bool) bool {
+	if v, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return v
+	}
+	return def
+}
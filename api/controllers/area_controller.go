@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AreaController exposes turf polygon management to admins.
+type AreaController struct {
+	Service *services.AreaService
+}
+
+type areaRequest struct {
+	Name    string               `json:"name"`
+	Polygon repositories.GeoJSON `json:"polygon"`
+}
+
+func (ac *AreaController) CreateArea(c *gin.Context) {
+	var req areaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid area data"})
+		return
+	}
+
+	area, err := ac.Service.CreateArea(c.Request.Context(), req.Name, req.Polygon)
+	if err != nil {
+		respondError(c, err, "failed to create area")
+		return
+	}
+	c.JSON(http.StatusCreated, area)
+}
+
+func (ac *AreaController) ListAreas(c *gin.Context) {
+	areas, err := ac.Service.ListAreas(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list areas"})
+		return
+	}
+	if areas == nil {
+		areas = []repositories.Area{}
+	}
+	c.JSON(http.StatusOK, areas)
+}
+
+func (ac *AreaController) GetArea(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+
+	area, err := ac.Service.GetArea(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "failed to fetch area")
+		return
+	}
+	c.JSON(http.StatusOK, area)
+}
+
+func (ac *AreaController) UpdateArea(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+
+	var req areaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid area data"})
+		return
+	}
+
+	area, err := ac.Service.UpdateArea(c.Request.Context(), id, req.Name, req.Polygon)
+	if err != nil {
+		respondError(c, err, "failed to update area")
+		return
+	}
+	c.JSON(http.StatusOK, area)
+}
+
+func (ac *AreaController) DeleteArea(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+
+	if err := ac.Service.DeleteArea(c.Request.Context(), id); err != nil {
+		respondError(c, err, "failed to delete area")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "area deleted"})
+}
+
+// areaID parses the :id path parameter, writing a 400 if it is malformed.
+func areaID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid area id"})
+		return 0, false
+	}
+	return id, true
+}
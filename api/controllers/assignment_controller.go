@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"altrinity/api/middleware"
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AssignmentController lets admins hand out stops and volunteers see theirs.
+type AssignmentController struct {
+	Service *services.AssignmentService
+}
+
+type assignmentRequest struct {
+	VolunteerID string `json:"volunteerId"`
+	services.AssignmentTarget
+}
+
+type reassignRequest struct {
+	FromVolunteerID string `json:"fromVolunteerId"`
+	ToVolunteerID   string `json:"toVolunteerId"`
+	services.AssignmentTarget
+}
+
+// Assign gives a volunteer a list of stops or every stop in an area.
+func (ac *AssignmentController) Assign(c *gin.Context) {
+	var req assignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid assignment data"})
+		return
+	}
+
+	assigned, err := ac.Service.Assign(c.Request.Context(), req.VolunteerID, req.AssignmentTarget)
+	if err != nil {
+		respondError(c, err, "failed to assign stops")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"assigned": nonNilInts(assigned)})
+}
+
+// Unassign removes stops from a volunteer; omitting stopIds and areaId removes all of them.
+func (ac *AssignmentController) Unassign(c *gin.Context) {
+	var req assignmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid assignment data"})
+		return
+	}
+
+	removed, err := ac.Service.Unassign(c.Request.Context(), req.VolunteerID, req.AssignmentTarget)
+	if err != nil {
+		respondError(c, err, "failed to unassign stops")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unassigned": nonNilInts(removed)})
+}
+
+// Reassign moves stops between volunteers; omitting stopIds and areaId moves all of them.
+func (ac *AssignmentController) Reassign(c *gin.Context) {
+	var req reassignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid assignment data"})
+		return
+	}
+
+	moved, err := ac.Service.Reassign(c.Request.Context(), req.FromVolunteerID, req.ToVolunteerID, req.AssignmentTarget)
+	if err != nil {
+		respondError(c, err, "failed to reassign stops")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reassigned": nonNilInts(moved)})
+}
+
+// ListAssignments is the admin view, filterable by ?volunteerId= and ?areaId=.
+func (ac *AssignmentController) ListAssignments(c *gin.Context) {
+	areaID := 0
+	if v := c.Query("areaId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid area id"})
+			return
+		}
+		areaID = id
+	}
+
+	list, err := ac.Service.ListAssignments(c.Request.Context(), c.Query("volunteerId"), areaID)
+	if err != nil {
+		respondError(c, err, "failed to list assignments")
+		return
+	}
+	if list == nil {
+		list = []repositories.Assignment{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// MyAssignments returns the caller's stops, nearest first.
+func (ac *AssignmentController) MyAssignments(c *gin.Context) {
+	list, err := ac.Service.MyAssignments(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch assignments"})
+		return
+	}
+	if list == nil {
+		list = []repositories.Assignment{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Volunteer subscribes to their own assignment changes via WebSocket.
+func (ac *AssignmentController) StreamAssignments(c *gin.Context) {
+	tokenStr := c.Query("token")
+	if tokenStr == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+		return
+	}
+
+	ok, user, err := middleware.VerifyJWT(tokenStr, "volunteer")
+	if !ok || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or unauthorized token"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		fmt.Println("websocket upgrade failed:", err)
+		return
+	}
+	hub := ac.Service.Hub
+	client := newWSClient(conn, user.ExpiresAt, &hub.Metrics)
+
+	reg := hub.Register(repositories.AssignmentChannel(user.ID), func(payload []byte) bool {
+		return client.Enqueue(json.RawMessage(payload), false)
+	})
+	client.Run(nil)
+	hub.Unregister(reg)
+}
+
+func nonNilInts(ids []int) []int {
+	if ids == nil {
+		return []int{}
+	}
+	return ids
+}
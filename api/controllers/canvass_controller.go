@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"altrinity/api/middleware"
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CanvassController records what happened at each door.
+type CanvassController struct {
+	Service *services.CanvassService
+}
+
+// Volunteer records the outcome of knocking on an assigned stop.
+func (cc *CanvassController) RecordResult(c *gin.Context) {
+	stopID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || stopID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stop id"})
+		return
+	}
+
+	var res repositories.CanvassResult
+	if err := c.ShouldBindJSON(&res); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid result data"})
+		return
+	}
+
+	token := c.GetHeader("Authorization")
+	tokenStr := strings.TrimPrefix(token, "Bearer ")
+
+	ok, user, err := middleware.VerifyJWT(tokenStr, "volunteer")
+	if !ok || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or unauthorized token"})
+		return
+	}
+
+	// Always trust identity from token
+	res.StopID = stopID
+	res.VolunteerID = user.ID
+
+	saved, err := cc.Service.RecordResult(c.Request.Context(), res)
+	if err != nil {
+		respondError(c, err, "failed to record result")
+		return
+	}
+	c.JSON(http.StatusCreated, saved)
+}
+
+func (cc *CanvassController) AreaSummary(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+
+	sum, err := cc.Service.AreaSummary(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "failed to summarize results")
+		return
+	}
+	c.JSON(http.StatusOK, sum)
+}
+
+func (cc *CanvassController) VolunteerSummary(c *gin.Context) {
+	sum, err := cc.Service.VolunteerSummary(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err, "failed to summarize results")
+		return
+	}
+	c.JSON(http.StatusOK, sum)
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"altrinity/api/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DispatchController proposes and commits automatic stop assignments.
+type DispatchController struct {
+	Service *services.DispatchService
+}
+
+// Preview proposes who should walk which unassigned stops, e.g.
+// {"areaId": 3, "mode": "turfs", "capacity": 40}. Nothing is assigned.
+func (dc *DispatchController) Preview(c *gin.Context) {
+	var req services.DispatchRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dispatch request"})
+			return
+		}
+	}
+
+	p, err := dc.Service.Preview(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err, "failed to plan dispatch")
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// Commit assigns a proposal returned by Preview, possibly edited:
+// {"assignments": [{"volunteerId": "...", "stopIds": [1, 2]}]}.
+func (dc *DispatchController) Commit(c *gin.Context) {
+	var req struct {
+		Assignments []services.DispatchAssignment `json:"assignments"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid dispatch proposal"})
+		return
+	}
+
+	results, err := dc.Service.Commit(c.Request.Context(), req.Assignments)
+	if err != nil {
+		respondError(c, err, "failed to commit dispatch")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"results": results})
+}
@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportController streams positions, tracks and canvass results for GIS
+// tools.
+type ExportController struct {
+	Service *services.ExportService
+}
+
+// Export streams a dataset (positions, tracks or results) as
+// ?format=geojson|gpx|kml|csv, filtered by ?areaId=, ?volunteerId= and
+// ?from=/?to=, which default to the last 7 days.
+func (ec *ExportController) Export(c *gin.Context) {
+	from, to, ok := timeWindow(c, 7*24*time.Hour)
+	if !ok {
+		return
+	}
+	filter := repositories.ExportFilter{VolunteerID: c.Query("volunteerId"), From: from, To: to}
+	if v := c.Query("areaId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid area id"})
+			return
+		}
+		filter.AreaID = id
+	}
+
+	export, err := ec.Service.Prepare(c.Param("dataset"), c.Query("format"), &filter)
+	if err != nil {
+		respondError(c, err, "failed to export")
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", export.Filename))
+	c.Status(http.StatusOK)
+	// Headers are gone by now, so a failure can only cut the file short.
+	if err := ec.Service.Write(c.Request.Context(), c.Writer, export, filter); err != nil {
+		log.Printf("export %s as %s failed: %v", export.Dataset, export.Format, err)
+	}
+}
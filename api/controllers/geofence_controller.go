@@ -0,0 +1,27 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GeofenceController lists out-of-turf alerts for the Command Hub.
+type GeofenceController struct {
+	Service *services.GeofenceService
+}
+
+// ListAlerts returns recent alerts; ?open=true limits to uncleared ones.
+func (gc *GeofenceController) ListAlerts(c *gin.Context) {
+	alerts, err := gc.Service.ListAlerts(c.Request.Context(), c.Query("open") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list alerts"})
+		return
+	}
+	if alerts == nil {
+		alerts = []repositories.GeofenceAlert{}
+	}
+	c.JSON(http.StatusOK, alerts)
+}
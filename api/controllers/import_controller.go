@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"altrinity/api/services"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportController loads GIS files into areas and stops.
+type ImportController struct {
+	Service *services.ImportService
+}
+
+// ImportAreas creates areas from a GeoJSON, KML/KMZ or zipped Shapefile upload.
+func (ic *ImportController) ImportAreas(c *gin.Context) {
+	data, opts, ok := importUpload(c)
+	if !ok {
+		return
+	}
+
+	report, err := ic.Service.ImportAreas(c.Request.Context(), data, opts)
+	if err != nil {
+		respondError(c, err, "failed to import areas")
+		return
+	}
+	c.JSON(importStatus(report), report)
+}
+
+// ImportStops adds stops to an area from a CSV, GeoJSON, KML/KMZ or zipped
+// Shapefile upload.
+func (ic *ImportController) ImportStops(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+	data, opts, ok := importUpload(c)
+	if !ok {
+		return
+	}
+
+	report, err := ic.Service.ImportStops(c.Request.Context(), id, data, opts)
+	if err != nil {
+		respondError(c, err, "failed to import stops")
+		return
+	}
+	c.JSON(importStatus(report), report)
+}
+
+// importUpload reads the file from a multipart "file" field or the raw body,
+// with ?format=, ?srid=, ?nameField= and ?dryRun=true.
+func importUpload(c *gin.Context) ([]byte, services.ImportOptions, bool) {
+	opts := services.ImportOptions{
+		Format:    c.Query("format"),
+		NameField: c.Query("nameField"),
+		DryRun:    c.Query("dryRun") == "true",
+	}
+	if v := c.Query("srid"); v != "" {
+		srid, err := strconv.Atoi(v)
+		if err != nil || srid <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid srid"})
+			return nil, opts, false
+		}
+		opts.SRID = srid
+	}
+
+	// Only parse a form for multipart: ParseForm would swallow a raw upload
+	// sent as application/x-www-form-urlencoded, curl's default.
+	body := io.Reader(c.Request.Body)
+	if c.ContentType() == "multipart/form-data" {
+		fh, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "multipart upload needs a \"file\" field"})
+			return nil, opts, false
+		}
+		f, err := fh.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cannot read upload"})
+			return nil, opts, false
+		}
+		defer f.Close()
+		body, opts.Filename = f, fh.Filename
+	}
+	data, err := io.ReadAll(io.LimitReader(body, services.MaxImportBytes+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot read upload"})
+		return nil, opts, false
+	}
+	return data, opts, true
+}
+
+// importStatus is 201 when anything was created and 200 otherwise, so a
+// dry run or an all-errors file is not mistaken for a successful import.
+func importStatus(r services.ImportReport) int {
+	if !r.DryRun && r.Imported > 0 {
+		return http.StatusCreated
+	}
+	return http.StatusOK
+}
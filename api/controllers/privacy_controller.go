@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrivacyController lets volunteers decide how their location is shared and
+// shows admins who has limited it.
+type PrivacyController struct {
+	Service *services.PrivacyService
+}
+
+// Volunteer reads their own sharing settings.
+func (pc *PrivacyController) GetMine(c *gin.Context) {
+	user, ok := volunteer(c)
+	if !ok {
+		return
+	}
+
+	p, err := pc.Service.Get(c.Request.Context(), user.ID)
+	if err != nil {
+		respondError(c, err, "failed to load privacy settings")
+		return
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// Volunteer replaces their sharing settings, e.g.
+// {"paused": false, "shiftOnly": true, "coarseMeters": 200}.
+func (pc *PrivacyController) UpdateMine(c *gin.Context) {
+	var p repositories.PrivacySettings
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid privacy settings"})
+		return
+	}
+	user, ok := volunteer(c)
+	if !ok {
+		return
+	}
+
+	// Always trust identity from token
+	p.VolunteerID, p.FullName = user.ID, user.FullName
+	saved, err := pc.Service.Update(c.Request.Context(), p)
+	if err != nil {
+		respondError(c, err, "failed to save privacy settings")
+		return
+	}
+	c.JSON(http.StatusOK, saved)
+}
+
+// Admin lists volunteers who paused or limited sharing.
+func (pc *PrivacyController) ListRestricted(c *gin.Context) {
+	list, err := pc.Service.ListRestricted(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "failed to list privacy settings")
+		return
+	}
+	out := make([]gin.H, 0, len(list))
+	for _, p := range list {
+		out = append(out, gin.H{
+			"volunteerId": p.VolunteerID,
+			"fullName":    p.FullName,
+			"sharing":     p.Sharing(),
+			"updatedAt":   p.UpdatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
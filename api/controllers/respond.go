@@ -0,0 +1,31 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondError maps service errors onto HTTP statuses; anything unexpected
+// is reported with the generic fallback message.
+func respondError(c *gin.Context, err error, fallback string) {
+	var verr *services.ValidationError
+	switch {
+	case errors.As(err, &verr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": verr.Error()})
+	case errors.Is(err, repositories.ErrAreaNotFound), errors.Is(err, repositories.ErrStopNotFound),
+		errors.Is(err, repositories.ErrIncidentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrAreaInUse), errors.Is(err, repositories.ErrStopInUse),
+		errors.Is(err, repositories.ErrStopAlreadyAssigned), errors.Is(err, repositories.ErrShiftAlreadyOpen),
+		errors.Is(err, repositories.ErrIncidentState):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrStopNotAssigned), errors.Is(err, repositories.ErrNoOpenShift):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"altrinity/api/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RetentionController exposes the location retention policy and lets admins
+// erase a volunteer's location data on request.
+type RetentionController struct {
+	Service *services.RetentionService
+}
+
+func (rc *RetentionController) GetPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, rc.Service.Policy())
+}
+
+// PurgeVolunteer deletes every stored location of a volunteer and reports
+// how much was removed.
+func (rc *RetentionController) PurgeVolunteer(c *gin.Context) {
+	res, err := rc.Service.PurgeVolunteer(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err, "failed to purge location data")
+		return
+	}
+	c.JSON(http.StatusOK, res)
+}
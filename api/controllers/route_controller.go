@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"altrinity/api/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RouteController serves walking routes over assigned stops. Fresh plans are
+// also pushed on /ws/assignments whenever stops are added or completed.
+type RouteController struct {
+	Service *services.RouteService
+}
+
+// MyRoute returns the caller's outstanding stops in walking order.
+func (rc *RouteController) MyRoute(c *gin.Context) {
+	route, err := rc.Service.Plan(c.Request.Context(), c.GetString("user_id"))
+	if err != nil {
+		respondError(c, err, "failed to plan route")
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
+
+// VolunteerRoute is the admin view of a volunteer's planned route.
+func (rc *RouteController) VolunteerRoute(c *gin.Context) {
+	route, err := rc.Service.VolunteerRoute(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err, "failed to plan route")
+		return
+	}
+	c.JSON(http.StatusOK, route)
+}
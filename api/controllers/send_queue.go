@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"altrinity/api/services"
+	"sync"
+)
+
+// Per-client outbound queue limits, shared by WebSocket and SSE streams.
+const (
+	streamSendBuffer = 256 // queued messages per client
+	streamMaxDrops   = 64  // consecutive dropped messages before disconnecting
+)
+
+// sendQueue is a bounded outbound queue for one stream client, applying the
+// slow-consumer policy: when full, a droppable message (one superseded by
+// later updates) is discarded, up to streamMaxDrops in a row; anything else
+// disconnects the client, which can reconnect and resume. Done is closed once
+// the client is finished for any reason.
+type sendQueue struct {
+	ch      chan []byte
+	done    chan struct{}
+	once    sync.Once
+	metrics *services.StreamMetrics
+
+	mu        sync.Mutex
+	drops     int
+	closeCode int
+	closeText string
+}
+
+func newSendQueue(metrics *services.StreamMetrics) *sendQueue {
+	return &sendQueue{
+		ch:      make(chan []byte, streamSendBuffer),
+		done:    make(chan struct{}),
+		metrics: metrics,
+	}
+}
+
+// Done is closed once the client is finished.
+func (q *sendQueue) Done() <-chan struct{} { return q.done }
+
+// push queues data without blocking; it returns false once the client is closing.
+func (q *sendQueue) push(data []byte, droppable bool) bool {
+	select {
+	case <-q.done:
+		return false
+	case q.ch <- data:
+		q.mu.Lock()
+		q.drops = 0
+		q.mu.Unlock()
+		q.metrics.Delivered()
+		return true
+	default:
+	}
+
+	q.metrics.Dropped()
+	q.mu.Lock()
+	q.drops++
+	tooSlow := !droppable || q.drops > streamMaxDrops
+	q.mu.Unlock()
+	if tooSlow {
+		q.metrics.SlowDisconnect()
+		q.Close(closeSlowConsumer, "slow consumer")
+		return false
+	}
+	return true
+}
+
+// pushWait queues data, waiting for room; used while a client catches up.
+func (q *sendQueue) pushWait(data []byte) bool {
+	select {
+	case <-q.done:
+		return false
+	case q.ch <- data:
+		q.metrics.Delivered()
+		return true
+	}
+}
+
+// Close records why the client is being disconnected and signals the writer.
+func (q *sendQueue) Close(code int, text string) {
+	q.once.Do(func() {
+		q.mu.Lock()
+		q.closeCode, q.closeText = code, text
+		q.mu.Unlock()
+		close(q.done)
+	})
+}
+
+func (q *sendQueue) closeReason() (int, string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.closeCode, q.closeText
+}
@@ -0,0 +1,77 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SettingsController lets admins tune position thresholds at runtime,
+// globally or per area, e.g. sparser persistence for rural turf.
+type SettingsController struct {
+	Service *services.SettingsService
+}
+
+// GetPositionSettings returns the env defaults, the effective global values
+// and every stored override.
+func (sc *SettingsController) GetPositionSettings(c *gin.Context) {
+	view, err := sc.Service.Get(c.Request.Context())
+	if err != nil {
+		respondError(c, err, "failed to load position settings")
+		return
+	}
+	c.JSON(http.StatusOK, view)
+}
+
+// UpdatePositionSettings replaces the global override; omitted or null
+// fields fall back to the env defaults.
+func (sc *SettingsController) UpdatePositionSettings(c *gin.Context) {
+	sc.update(c, nil)
+}
+
+// ResetPositionSettings drops the global override.
+func (sc *SettingsController) ResetPositionSettings(c *gin.Context) {
+	sc.reset(c, nil)
+}
+
+// UpdateAreaPositionSettings replaces an area's override; omitted or null
+// fields inherit the global values.
+func (sc *SettingsController) UpdateAreaPositionSettings(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+	sc.update(c, &id)
+}
+
+// ResetAreaPositionSettings drops an area's override.
+func (sc *SettingsController) ResetAreaPositionSettings(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+	sc.reset(c, &id)
+}
+
+func (sc *SettingsController) update(c *gin.Context, areaID *int) {
+	var req repositories.PositionSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid settings"})
+		return
+	}
+	if err := sc.Service.Update(c.Request.Context(), areaID, req); err != nil {
+		respondError(c, err, "failed to update position settings")
+		return
+	}
+	sc.GetPositionSettings(c)
+}
+
+func (sc *SettingsController) reset(c *gin.Context, areaID *int) {
+	if err := sc.Service.Reset(c.Request.Context(), areaID); err != nil {
+		respondError(c, err, "failed to reset position settings")
+		return
+	}
+	sc.GetPositionSettings(c)
+}
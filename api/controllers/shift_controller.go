@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"altrinity/api/middleware"
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShiftController handles volunteer check-in/check-out and the admin views
+// of hours worked.
+type ShiftController struct {
+	Service *services.ShiftService
+}
+
+// volunteer reads the volunteer's identity from the bearer token.
+func volunteer(c *gin.Context) (*middleware.VerifiedUser, bool) {
+	tokenStr := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	ok, user, err := middleware.VerifyJWT(tokenStr, "volunteer")
+	if !ok || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or unauthorized token"})
+		return user, false
+	}
+	return user, true
+}
+
+// Volunteer checks in, optionally to an area: {"areaId": 3}.
+func (sc *ShiftController) CheckIn(c *gin.Context) {
+	var req struct {
+		AreaID *int `json:"areaId"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid check-in data"})
+			return
+		}
+	}
+	user, ok := volunteer(c)
+	if !ok {
+		return
+	}
+
+	shift, err := sc.Service.CheckIn(c.Request.Context(), user.ID, user.FullName, req.AreaID)
+	if err != nil {
+		respondError(c, err, "failed to check in")
+		return
+	}
+	c.JSON(http.StatusCreated, shift)
+}
+
+// Volunteer checks out, ending tracking; the response carries the totals.
+func (sc *ShiftController) CheckOut(c *gin.Context) {
+	user, ok := volunteer(c)
+	if !ok {
+		return
+	}
+
+	shift, err := sc.Service.CheckOut(c.Request.Context(), user.ID)
+	if err != nil {
+		respondError(c, err, "failed to check out")
+		return
+	}
+	c.JSON(http.StatusOK, shift)
+}
+
+// Volunteer asks whether they are checked in; shift is null if not.
+func (sc *ShiftController) CurrentShift(c *gin.Context) {
+	user, ok := volunteer(c)
+	if !ok {
+		return
+	}
+
+	shift, err := sc.Service.Current(c.Request.Context(), user.ID)
+	if errors.Is(err, repositories.ErrNoOpenShift) {
+		c.JSON(http.StatusOK, gin.H{"shift": nil})
+		return
+	}
+	if err != nil {
+		respondError(c, err, "failed to fetch shift")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"shift": shift})
+}
+
+// Admin lists shifts overlapping from/to (default last 24 hours),
+// optionally for one ?volunteerId=.
+func (sc *ShiftController) ListShifts(c *gin.Context) {
+	from, to, ok := timeWindow(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	shifts, err := sc.Service.List(c.Request.Context(), c.Query("volunteerId"), from, to)
+	if err != nil {
+		respondError(c, err, "failed to list shifts")
+		return
+	}
+	if shifts == nil {
+		shifts = []repositories.Shift{}
+	}
+	c.JSON(http.StatusOK, shifts)
+}
+
+// Admin totals hours, distance and doors per volunteer for shifts started
+// between from and to; the default window is the last 30 days.
+func (sc *ShiftController) ShiftTotals(c *gin.Context) {
+	from, to, ok := timeWindow(c, 30*24*time.Hour)
+	if !ok {
+		return
+	}
+
+	totals, err := sc.Service.Totals(c.Request.Context(), from, to)
+	if err != nil {
+		respondError(c, err, "failed to total shifts")
+		return
+	}
+	if totals == nil {
+		totals = []repositories.ShiftTotals{}
+	}
+	c.JSON(http.StatusOK, totals)
+}
@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SOSController handles volunteer emergencies and their handling by admins.
+type SOSController struct {
+	Service *services.SOSService
+}
+
+// Volunteer raises an emergency; position and message are optional.
+func (sc *SOSController) Raise(c *gin.Context) {
+	var req services.SOSRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid sos data"})
+			return
+		}
+	}
+	user, ok := volunteer(c)
+	if !ok {
+		return
+	}
+
+	in, err := sc.Service.Raise(c.Request.Context(), user.ID, user.FullName, req)
+	if err != nil {
+		respondError(c, err, "failed to raise sos")
+		return
+	}
+	c.JSON(http.StatusCreated, in)
+}
+
+// Admin lists incidents; ?status= is open, acknowledged or resolved and
+// defaults to every unresolved incident.
+func (sc *SOSController) ListIncidents(c *gin.Context) {
+	list, err := sc.Service.List(c.Request.Context(), c.Query("status"))
+	if err != nil {
+		respondError(c, err, "failed to list incidents")
+		return
+	}
+	if list == nil {
+		list = []repositories.Incident{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Admin fetches one incident with its notes.
+func (sc *SOSController) GetIncident(c *gin.Context) {
+	id, ok := incidentID(c)
+	if !ok {
+		return
+	}
+	in, err := sc.Service.Get(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "failed to fetch incident")
+		return
+	}
+	c.JSON(http.StatusOK, in)
+}
+
+// Admin acknowledges an open incident, stopping the reminders: {"note": "..."}.
+func (sc *SOSController) Acknowledge(c *gin.Context) {
+	sc.transition(c, sc.Service.Acknowledge, "failed to acknowledge incident")
+}
+
+// Admin resolves an incident: {"note": "..."}.
+func (sc *SOSController) Resolve(c *gin.Context) {
+	sc.transition(c, sc.Service.Resolve, "failed to resolve incident")
+}
+
+func (sc *SOSController) transition(c *gin.Context, fn func(ctx context.Context, id int, adminID, adminName, note string) (repositories.Incident, error), fallback string) {
+	id, ok := incidentID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Note string `json:"note"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note"})
+			return
+		}
+	}
+
+	in, err := fn(c.Request.Context(), id, c.GetString("user_id"), c.GetString("username"), req.Note)
+	if err != nil {
+		respondError(c, err, fallback)
+		return
+	}
+	c.JSON(http.StatusOK, in)
+}
+
+// Admin adds a note to an incident: {"body": "..."}.
+func (sc *SOSController) AddNote(c *gin.Context) {
+	id, ok := incidentID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid note"})
+		return
+	}
+
+	note, err := sc.Service.AddNote(c.Request.Context(), id, c.GetString("user_id"), c.GetString("username"), req.Body)
+	if err != nil {
+		respondError(c, err, "failed to add note")
+		return
+	}
+	c.JSON(http.StatusCreated, note)
+}
+
+func incidentID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid incident id"})
+		return 0, false
+	}
+	return id, true
+}
@@ -0,0 +1,133 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sseWriteWait      = 10 * time.Second
+	sseHeartbeatEvery = 15 * time.Second // keeps proxies from idling the connection out
+	sseRetryMillis    = 2000             // reconnect delay suggested to the browser
+)
+
+// sseClient is the Server-Sent Events counterpart of wsClient, for networks
+// that block WebSocket upgrades. Feed events carry their sequence number as
+// the SSE id, so a browser's automatic reconnect resumes via Last-Event-ID.
+type sseClient struct {
+	*sendQueue
+	w       gin.ResponseWriter
+	rc      *http.ResponseController
+	expires time.Time
+}
+
+func newSSEClient(w gin.ResponseWriter, expires time.Time, metrics *services.StreamMetrics) *sseClient {
+	return &sseClient{
+		sendQueue: newSendQueue(metrics),
+		w:         w,
+		rc:        http.NewResponseController(w),
+		expires:   expires,
+	}
+}
+
+// Enqueue queues v as an SSE message under the slow-consumer policy.
+func (c *sseClient) Enqueue(v interface{}, droppable bool) bool {
+	data, ok := formatSSE(v)
+	if !ok {
+		return true
+	}
+	return c.push(data, droppable)
+}
+
+// EnqueueWait queues v, waiting for room in the queue.
+func (c *sseClient) EnqueueWait(v interface{}) bool {
+	data, ok := formatSSE(v)
+	if !ok {
+		return true
+	}
+	return c.pushWait(data)
+}
+
+func formatSSE(v interface{}) ([]byte, bool) {
+	var buf bytes.Buffer
+	if ev, ok := v.(repositories.StreamEvent); ok {
+		buf.WriteString("id: " + strconv.FormatInt(ev.Seq, 10) + "\n")
+		buf.WriteString("event: " + ev.Type + "\n")
+		v = ev
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	buf.WriteString("data: ")
+	buf.Write(data)
+	buf.WriteString("\n\n")
+	return buf.Bytes(), true
+}
+
+// Run writes queued messages until the client goes away, the token expires
+// or the queue is closed. done is the request context's Done channel.
+func (c *sseClient) Run(done <-chan struct{}) {
+	h := c.w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no") // disable nginx response buffering
+	c.w.WriteHeader(http.StatusOK)
+	if !c.write([]byte("retry: " + strconv.Itoa(sseRetryMillis) + "\n\n")) {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatEvery)
+	defer heartbeat.Stop()
+
+	var expired <-chan time.Time
+	if !c.expires.IsZero() {
+		timer := time.NewTimer(time.Until(c.expires))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	for {
+		select {
+		case data := <-c.ch:
+			if !c.write(data) {
+				return
+			}
+		case <-heartbeat.C:
+			if !c.write([]byte(": ping\n\n")) {
+				return
+			}
+		case <-expired:
+			c.Close(closeTokenExpired, "token expired")
+		case <-done:
+			c.Close(0, "")
+			return
+		case <-c.done:
+			if code, text := c.closeReason(); code != 0 {
+				c.write([]byte("event: close\ndata: " + strconv.Quote(text) + "\n\n"))
+			}
+			return
+		}
+	}
+}
+
+func (c *sseClient) write(data []byte) bool {
+	c.rc.SetWriteDeadline(time.Now().Add(sseWriteWait))
+	if _, err := c.w.Write(data); err != nil {
+		c.Close(0, "")
+		return false
+	}
+	if err := c.rc.Flush(); err != nil {
+		c.Close(0, "")
+		return false
+	}
+	return true
+}
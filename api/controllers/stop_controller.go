@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StopController manages the doors/locations inside an area.
+type StopController struct {
+	Service *services.StopService
+}
+
+func (sc *StopController) CreateStop(c *gin.Context) {
+	areaID, ok := areaID(c)
+	if !ok {
+		return
+	}
+
+	var stop services.StopRequest
+	if err := c.ShouldBindJSON(&stop); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stop data"})
+		return
+	}
+
+	created, err := sc.Service.CreateStop(c.Request.Context(), areaID, stop)
+	if err != nil {
+		respondError(c, err, "failed to create stop")
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+func (sc *StopController) BulkCreateStops(c *gin.Context) {
+	areaID, ok := areaID(c)
+	if !ok {
+		return
+	}
+
+	var stops []services.StopRequest
+	if err := c.ShouldBindJSON(&stops); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stop data"})
+		return
+	}
+
+	created, err := sc.Service.CreateStops(c.Request.Context(), areaID, stops)
+	if err != nil {
+		respondError(c, err, "failed to create stops")
+		return
+	}
+	c.JSON(http.StatusCreated, created)
+}
+
+// ListStops returns an area's stops. It optionally narrows the result with
+// either ?lat=&lng=&radius= (meters) or ?bbox=minLng,minLat,maxLng,maxLat.
+func (sc *StopController) ListStops(c *gin.Context) {
+	areaID, ok := areaID(c)
+	if !ok {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var (
+		stops []repositories.Stop
+		err   error
+	)
+	switch {
+	case c.Query("bbox") != "":
+		box, perr := parseFloats(c.Query("bbox"), 4)
+		if perr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "bbox must be minLng,minLat,maxLng,maxLat"})
+			return
+		}
+		stops, err = sc.Service.StopsInBBox(ctx, areaID, box[0], box[1], box[2], box[3])
+	case c.Query("radius") != "":
+		point, perr := parseFloats(c.Query("lat")+","+c.Query("lng")+","+c.Query("radius"), 3)
+		if perr != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lat, lng and radius must be numbers"})
+			return
+		}
+		stops, err = sc.Service.StopsNear(ctx, areaID, point[0], point[1], point[2])
+	default:
+		stops, err = sc.Service.ListStops(ctx, areaID)
+	}
+	if err != nil {
+		respondError(c, err, "failed to list stops")
+		return
+	}
+	if stops == nil {
+		stops = []repositories.Stop{}
+	}
+	c.JSON(http.StatusOK, stops)
+}
+
+func (sc *StopController) DeleteStop(c *gin.Context) {
+	areaID, ok := areaID(c)
+	if !ok {
+		return
+	}
+	stopID, err := strconv.Atoi(c.Param("stopId"))
+	if err != nil || stopID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid stop id"})
+		return
+	}
+
+	if err := sc.Service.DeleteStop(c.Request.Context(), areaID, stopID); err != nil {
+		respondError(c, err, "failed to delete stop")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "stop deleted"})
+}
+
+// parseFloats splits a comma-separated list into exactly n floats.
+func parseFloats(s string, n int) ([]float64, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != n {
+		return nil, strconv.ErrSyntax
+	}
+	out := make([]float64, n)
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = f
+	}
+	return out, nil
+}
@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"altrinity/api/repositories"
+	"altrinity/api/services"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamSink is what the live feed needs from a WebSocket or SSE client.
+type streamSink interface {
+	Enqueue(v interface{}, droppable bool) bool
+	EnqueueWait(v interface{}) bool
+	Close(code int, text string)
+	Done() <-chan struct{}
+}
+
+// deliverTo adapts a client to the hub. Catch-up waits for queue space; live
+// positions may be dropped for a slow client since a newer one supersedes
+// them, but alerts may not.
+func deliverTo(sink streamSink) func(repositories.StreamEvent, bool) bool {
+	return func(ev repositories.StreamEvent, catchingUp bool) bool {
+		if catchingUp {
+			return sink.EnqueueWait(ev)
+		}
+		return sink.Enqueue(ev, ev.Type == services.EventPosition)
+	}
+}
+
+// streamSince reads the resume point from ?since= or, for SSE reconnects,
+// the Last-Event-ID header.
+func streamSince(c *gin.Context) (since int64, ok bool, err error) {
+	v := c.Query("since")
+	if v == "" {
+		v = c.GetHeader("Last-Event-ID")
+	}
+	if v == "" {
+		return 0, false, nil
+	}
+	since, err = strconv.ParseInt(v, 10, 64)
+	if err != nil || since < 0 {
+		return 0, false, strconv.ErrSyntax
+	}
+	return since, true, nil
+}
+
+// subscribeRequestFromQuery builds a filter request from ?bbox=, ?areaId= and
+// ?volunteerIds= for transports that cannot send subscribe messages.
+func subscribeRequestFromQuery(c *gin.Context) (services.SubscribeRequest, error) {
+	req := services.SubscribeRequest{Action: "subscribe"}
+	if v := c.Query("bbox"); v != "" {
+		box, err := parseFloats(v, 4)
+		if err != nil {
+			return req, err
+		}
+		req.BBox = box
+	}
+	if v := c.Query("areaId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return req, err
+		}
+		req.AreaID = id
+	}
+	if v := c.Query("volunteerIds"); v != "" {
+		req.VolunteerIDs = strings.Split(v, ",")
+	}
+	return req, nil
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"altrinity/api/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TurfController cuts areas into walk packets.
+type TurfController struct {
+	Service *services.TurfService
+}
+
+// Cut splits an area's stops into turfs, e.g.
+// {"k": 6, "balance": "time", "hull": "concave", "dryRun": true}.
+// Saving replaces any turfs previously cut from the area.
+func (tc *TurfController) Cut(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+	var req services.TurfRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid turf request"})
+		return
+	}
+
+	cut, err := tc.Service.Cut(c.Request.Context(), id, req)
+	if err != nil {
+		respondError(c, err, "failed to cut turfs")
+		return
+	}
+	status := http.StatusCreated
+	if cut.DryRun {
+		status = http.StatusOK
+	}
+	c.JSON(status, cut)
+}
+
+// ListTurfs returns the turfs cut from an area with their stop IDs.
+func (tc *TurfController) ListTurfs(c *gin.Context) {
+	id, ok := areaID(c)
+	if !ok {
+		return
+	}
+
+	turfs, err := tc.Service.List(c.Request.Context(), id)
+	if err != nil {
+		respondError(c, err, "failed to list turfs")
+		return
+	}
+	c.JSON(http.StatusOK, turfs)
+}
@@ -6,9 +6,11 @@ import (
 	"altrinity/api/services"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -17,6 +19,7 @@ import (
 // VolunteerController handles volunteer map updates and admin streams.
 type VolunteerController struct {
 	Service *services.VolunteerService
+	Stream  *services.StreamService
 }
 
 // Volunteer sends location updates periodically (mobile side).
@@ -40,26 +43,51 @@ func (vc *VolunteerController) UpdatePosition(c *gin.Context) {
 	pos.ID = user.ID
 	pos.FullName = user.FullName
 
-	// Persist position to PostGIS (optional)
+	// Validate, cache, publish to the admin feed and persist to PostGIS
 	if err := vc.Service.UpdatePosition(context.Background(), pos); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err, "failed to update position")
 		return
 	}
 
-	// Publish update to Redis so all admins see it
-	data, _ := json.Marshal(pos)
-	if err := vc.Service.Repo.Redis.Publish(context.Background(), "positions", string(data)).Err(); err != nil {
-		fmt.Println("redis publish error:", err)
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Volunteer uploads fixes queued while offline, each with its device timestamp.
+func (vc *VolunteerController) UploadPositions(c *gin.Context) {
+	var req struct {
+		Fixes []repositories.Position `json:"fixes"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid position data"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	token := c.GetHeader("Authorization")
+	tokenStr := strings.TrimPrefix(token, "Bearer ")
+
+	ok, user, err := middleware.VerifyJWT(tokenStr, "volunteer")
+	if !ok || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or unauthorized token"})
+		return
+	}
+
+	res, err := vc.Service.UploadBatch(c.Request.Context(), user.ID, user.FullName, req.Fixes)
+	if err != nil {
+		respondError(c, err, "failed to store positions")
+		return
+	}
+	c.JSON(http.StatusOK, res)
 }
 
-// Admin subscribes to Redis "positions" channel via WebSocket.
+// Admin follows the live position feed via WebSocket.
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
+// StreamPositions sends a snapshot of live positions followed by every feed
+// event, each tagged with its sequence number. A reconnecting client passes
+// ?since=<seq> to replay what it missed instead of taking a new snapshot.
+// The socket is closed when the admin's token expires.
 func (vc *VolunteerController) StreamPositions(c *gin.Context) {
 	tokenStr := c.Query("token")
 	if tokenStr == "" {
@@ -67,33 +95,113 @@ func (vc *VolunteerController) StreamPositions(c *gin.Context) {
 		return
 	}
 
-	ok, _, err := middleware.VerifyJWT(tokenStr, "admin")
+	ok, user, err := middleware.VerifyJWT(tokenStr, "admin")
 	if !ok || err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or unauthorized token"})
 		return
 	}
 
+	since, hasSince, err := streamSince(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a sequence number"})
+		return
+	}
+
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		fmt.Println("websocket upgrade failed:", err)
 		return
 	}
-	defer conn.Close()
+	client := newWSClient(conn, user.ExpiresAt, &vc.Stream.Metrics)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := services.NewSubscription(nil, deliverTo(client))
+
+	// The client narrows its feed by sending subscribe messages at any time;
+	// each accepted filter is followed by a fresh snapshot matching it, and
+	// live events resume after the snapshot.
+	onMessage := func(data []byte) {
+		var req services.SubscribeRequest
+		var f *services.StreamFilter
+		err := json.Unmarshal(data, &req)
+		if err != nil {
+			err = errors.New("invalid subscribe message")
+		} else {
+			f, err = vc.Stream.BuildFilter(ctx, req)
+		}
+		if err != nil {
+			client.Enqueue(gin.H{"type": "error", "error": err.Error()}, false)
+			return
+		}
+		client.Enqueue(gin.H{"type": "subscribed", "filter": req}, false)
+		if err := vc.Stream.Refilter(ctx, sub, f); err != nil {
+			client.Close(websocket.CloseTryAgainLater, err.Error())
+		}
+	}
+
+	go func() {
+		if err := vc.Stream.Subscribe(ctx, sub, since, hasSince); err != nil {
+			client.Close(websocket.CloseTryAgainLater, err.Error())
+		}
+	}()
+	client.Run(onMessage)
+	vc.Stream.Unsubscribe(sub)
+}
 
-	sub := vc.Service.Repo.Redis.Subscribe(context.Background(), "positions")
-	defer sub.Close()
+// StreamPositionsSSE serves the same feed as StreamPositions over
+// Server-Sent Events, authenticated with the Authorization header. Filters
+// come from ?bbox=, ?areaId= and ?volunteerIds=; changing them means
+// reconnecting, and Last-Event-ID (or ?since=) resumes where the client left off.
+func (vc *VolunteerController) StreamPositionsSSE(c *gin.Context) {
+	tokenStr := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	ok, user, err := middleware.VerifyJWT(tokenStr, "admin")
+	if !ok || err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or unauthorized token"})
+		return
+	}
 
-	for msg := range sub.Channel() {
-		// Each message payload already includes volunteer ID + full name
-		conn.WriteMessage(websocket.TextMessage, []byte(msg.Payload))
+	since, hasSince, err := streamSince(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a sequence number"})
+		return
+	}
+	req, err := subscribeRequestFromQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid filter parameters"})
+		return
 	}
+	filter, err := vc.Stream.BuildFilter(c.Request.Context(), req)
+	if err != nil {
+		respondError(c, err, "failed to build filter")
+		return
+	}
+
+	client := newSSEClient(c.Writer, user.ExpiresAt, &vc.Stream.Metrics)
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	sub := services.NewSubscription(filter, deliverTo(client))
+	go func() {
+		if err := vc.Stream.Subscribe(ctx, sub, since, hasSince); err != nil {
+			client.Close(closeSlowConsumer, err.Error())
+		}
+	}()
+	client.Run(ctx.Done())
+	vc.Stream.Unsubscribe(sub)
 }
 
-// REST endpoint for debugging / fallback (optional).
+// REST endpoint for debugging / fallback (optional). Each position carries
+// the volunteer's presence status; ?status=active,idle keeps only those.
 func (vc *VolunteerController) GetPositions(c *gin.Context) {
-	positions, err := vc.Service.GetAllPositions(context.Background())
+	var statuses []string
+	if v := c.Query("status"); v != "" {
+		statuses = strings.Split(v, ",")
+	}
+	positions, err := vc.Service.GetAllPositions(context.Background(), statuses)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch positions"})
+		respondError(c, err, "failed to fetch positions")
 		return
 	}
 	if positions == nil {
@@ -101,3 +209,60 @@ func (vc *VolunteerController) GetPositions(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, positions)
 }
+
+// timeWindow parses ?from= and ?to= as RFC 3339, defaulting to the span
+// before now.
+func timeWindow(c *gin.Context, span time.Duration) (from, to time.Time, ok bool) {
+	to = time.Now().UTC()
+	from = to.Add(-span)
+
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be an RFC 3339 timestamp"})
+			return from, to, false
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be an RFC 3339 timestamp"})
+			return from, to, false
+		}
+	}
+	return from, to, true
+}
+
+// Admin fetches a volunteer's breadcrumb trail; from/to are RFC 3339 and
+// default to the last 24 hours.
+func (vc *VolunteerController) GetTrack(c *gin.Context) {
+	from, to, ok := timeWindow(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	track, err := vc.Service.GetTrack(c.Request.Context(), c.Param("id"), from, to)
+	if err != nil {
+		respondError(c, err, "failed to fetch track")
+		return
+	}
+	c.JSON(http.StatusOK, track)
+}
+
+// Admin reviews fixes flagged as implausible, optionally for one
+// ?volunteerId=, over the same from/to window as tracks.
+func (vc *VolunteerController) GetFlagged(c *gin.Context) {
+	from, to, ok := timeWindow(c, 24*time.Hour)
+	if !ok {
+		return
+	}
+
+	fixes, err := vc.Service.ListFlagged(c.Request.Context(), c.Query("volunteerId"), from, to)
+	if err != nil {
+		respondError(c, err, "failed to fetch flagged positions")
+		return
+	}
+	if fixes == nil {
+		fixes = []repositories.FlaggedPosition{}
+	}
+	c.JSON(http.StatusOK, fixes)
+}
@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	"altrinity/api/services"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket connection tuning.
+const (
+	wsWriteWait      = 10 * time.Second    // deadline for any single write
+	wsPongWait       = 60 * time.Second    // client must answer pings within this
+	wsPingPeriod     = wsPongWait * 9 / 10 // must be shorter than wsPongWait
+	wsMaxMessageSize = 4096                // largest message a client may send
+)
+
+// Close codes in the private-use range, so clients can tell why they were cut off.
+const (
+	closeTokenExpired = 4001
+	closeSlowConsumer = 4008
+)
+
+// wsClient owns one WebSocket connection: a single writer goroutine drains a
+// bounded queue and sends pings, while a reader goroutine handles client
+// messages, pongs and close detection.
+type wsClient struct {
+	*sendQueue
+	conn    *websocket.Conn
+	expires time.Time
+}
+
+func newWSClient(conn *websocket.Conn, expires time.Time, metrics *services.StreamMetrics) *wsClient {
+	return &wsClient{sendQueue: newSendQueue(metrics), conn: conn, expires: expires}
+}
+
+// Enqueue queues v as a JSON text message under the slow-consumer policy.
+func (c *wsClient) Enqueue(v interface{}, droppable bool) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return true
+	}
+	return c.push(data, droppable)
+}
+
+// EnqueueWait queues v, waiting for room in the queue.
+func (c *wsClient) EnqueueWait(v interface{}) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return true
+	}
+	return c.pushWait(data)
+}
+
+// Run starts the reader and writer and blocks until the connection is done.
+// onMessage is called from the reader for every message the client sends.
+func (c *wsClient) Run(onMessage func([]byte)) {
+	go c.readPump(onMessage)
+	c.writePump()
+}
+
+func (c *wsClient) readPump(onMessage func([]byte)) {
+	defer c.Close(websocket.CloseNormalClosure, "")
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if onMessage != nil {
+			onMessage(data)
+		}
+	}
+}
+
+func (c *wsClient) writePump() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	var expired <-chan time.Time
+	if !c.expires.IsZero() {
+		timer := time.NewTimer(time.Until(c.expires))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	defer c.conn.Close()
+	for {
+		select {
+		case data := <-c.ch:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				c.Close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ping.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				c.Close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-expired:
+			c.Close(closeTokenExpired, "token expired")
+		case <-c.done:
+			if code, text := c.closeReason(); code != websocket.CloseAbnormalClosure {
+				msg := websocket.FormatCloseMessage(code, text)
+				c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(wsWriteWait))
+			}
+			return
+		}
+	}
+}
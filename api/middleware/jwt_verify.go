@@ -4,17 +4,19 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
 // VerifiedUser represents decoded JWT user info
 type VerifiedUser struct {
-	ID       string
-	Username string
-	Email    string
-	FullName string
-	Roles    []string
+	ID        string
+	Username  string
+	Email     string
+	FullName  string
+	Roles     []string
+	ExpiresAt time.Time // zero if the token has no exp claim
 }
 
 // VerifyJWT validates a JWT token using the cached JWKS.
@@ -43,6 +45,9 @@ func VerifyJWT(tokenStr string, requiredRole string) (bool, *VerifiedUser, error
 		Username: stringOrEmpty(claims["preferred_username"]),
 		Email:    stringOrEmpty(claims["email"]),
 	}
+	if exp, ok := claims["exp"].(float64); ok {
+		user.ExpiresAt = time.Unix(int64(exp), 0)
+	}
 
 	if full, ok := claims["name"].(string); ok {
 		user.FullName = full
@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrAreaNotFound = errors.New("area not found")
+	ErrAreaInUse    = errors.New("area still has stops")
+)
+
+type AreaRepository struct {
+	DB *sqlx.DB
+}
+
+type Area struct {
+	ID       int     `db:"id" json:"id"`
+	Name     string  `db:"name" json:"name"`
+	ParentID *int    `db:"parent_id" json:"parentId,omitempty"` // set on turfs cut from another area
+	Polygon  GeoJSON `db:"polygon" json:"polygon"`
+}
+
+// ValidatePolygon asks PostGIS whether a GeoJSON polygon is valid and, if not, why.
+func (r *AreaRepository) ValidatePolygon(ctx context.Context, polygon GeoJSON) (bool, string, error) {
+	var res struct {
+		Valid  bool   `db:"valid"`
+		Reason string `db:"reason"`
+	}
+	query := `
+	SELECT ST_IsValid(g) AS valid, ST_IsValidReason(g) AS reason
+	FROM (SELECT ST_SetSRID(ST_GeomFromGeoJSON($1), 4326) AS g) s`
+	err := r.DB.GetContext(ctx, &res, query, string(polygon))
+	return res.Valid, res.Reason, err
+}
+
+// Reproject transforms a GeoJSON geometry to EPSG:4326 from either an EPSG
+// code or, when wkt is set, a WKT definition such as a Shapefile .prj.
+func (r *AreaRepository) Reproject(ctx context.Context, geometry GeoJSON, srid int, wkt string) (GeoJSON, error) {
+	var out GeoJSON
+	var err error
+	if wkt != "" {
+		err = r.DB.GetContext(ctx, &out, `
+			SELECT ST_AsGeoJSON(ST_Transform(ST_GeomFromGeoJSON($1), $2::text, 4326), 9)`, string(geometry), wkt)
+	} else {
+		err = r.DB.GetContext(ctx, &out, `
+			SELECT ST_AsGeoJSON(ST_Transform(ST_SetSRID(ST_GeomFromGeoJSON($1), $2), 4326), 9)`, string(geometry), srid)
+	}
+	return out, err
+}
+
+func (r *AreaRepository) CreateArea(ctx context.Context, name string, polygon GeoJSON) (Area, error) {
+	var a Area
+	query := `
+	INSERT INTO areas (name, polygon)
+	VALUES ($1, ST_SetSRID(ST_GeomFromGeoJSON($2), 4326)::geography)
+	RETURNING id, name, parent_id, ST_AsGeoJSON(polygon) AS polygon`
+	err := r.DB.GetContext(ctx, &a, query, name, string(polygon))
+	return a, err
+}
+
+func (r *AreaRepository) ListAreas(ctx context.Context) ([]Area, error) {
+	var areas []Area
+	err := r.DB.SelectContext(ctx, &areas, `
+		SELECT id, COALESCE(name, '') AS name, parent_id, ST_AsGeoJSON(polygon) AS polygon
+		FROM areas ORDER BY id`)
+	return areas, err
+}
+
+func (r *AreaRepository) GetArea(ctx context.Context, id int) (Area, error) {
+	var a Area
+	err := r.DB.GetContext(ctx, &a, `
+		SELECT id, COALESCE(name, '') AS name, parent_id, ST_AsGeoJSON(polygon) AS polygon
+		FROM areas WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrAreaNotFound
+	}
+	return a, err
+}
+
+func (r *AreaRepository) UpdateArea(ctx context.Context, id int, name string, polygon GeoJSON) (Area, error) {
+	var a Area
+	query := `
+	UPDATE areas
+	SET name = $2, polygon = ST_SetSRID(ST_GeomFromGeoJSON($3), 4326)::geography
+	WHERE id = $1
+	RETURNING id, name, parent_id, ST_AsGeoJSON(polygon) AS polygon`
+	err := r.DB.GetContext(ctx, &a, query, id, name, string(polygon))
+	if errors.Is(err, sql.ErrNoRows) {
+		return a, ErrAreaNotFound
+	}
+	return a, err
+}
+
+func (r *AreaRepository) DeleteArea(ctx context.Context, id int) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM areas WHERE id = $1`, id)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" { // foreign_key_violation
+			return ErrAreaInUse
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrAreaNotFound
+	}
+	return nil
+}
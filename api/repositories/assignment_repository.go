@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var ErrStopAlreadyAssigned = errors.New("stop is already assigned to another volunteer")
+
+// dispatchLockKey keeps continuous dispatch to one API instance per round.
+const dispatchLockKey = "dispatch:lock"
+
+type AssignmentRepository struct {
+	DB    *sqlx.DB
+	Redis *redis.Client
+}
+
+type Assignment struct {
+	ID          int       `db:"id" json:"id"`
+	VolunteerID string    `db:"volunteer_id" json:"volunteerId"`
+	StopID      int       `db:"stop_id" json:"stopId"`
+	AreaID      int       `db:"area_id" json:"areaId"`
+	StopName    string    `db:"stop_name" json:"stopName"`
+	Lat         float64   `db:"lat" json:"lat"`
+	Lng         float64   `db:"lng" json:"lng"`
+	AssignedAt  time.Time `db:"assigned_at" json:"assignedAt"`
+	Distance    *float64  `db:"distance" json:"distanceMeters,omitempty"`
+}
+
+// AssignmentEvent is pushed to a volunteer whenever their stop list changes.
+type AssignmentEvent struct {
+	Type    string    `json:"type"` // "assigned" or "unassigned"
+	StopIDs []int     `json:"stopIds"`
+	At      time.Time `json:"at"`
+}
+
+const assignmentColumns = `a.id, a.volunteer_id, a.stop_id, s.area_id,
+	COALESCE(s.name, '') AS stop_name,
+	ST_Y(s.location::geometry) AS lat, ST_X(s.location::geometry) AS lng, a.assigned_at`
+
+// AssignmentChannel is the Redis pub/sub channel carrying a volunteer's assignment events.
+func AssignmentChannel(volunteerID string) string {
+	return fmt.Sprintf("assignments:%s", volunteerID)
+}
+
+// Assign gives the stops to a volunteer. Stops the volunteer already holds are
+// left untouched; stops held by someone else fail the whole call with
+// ErrStopAlreadyAssigned. It returns the newly assigned stop IDs.
+func (r *AssignmentRepository) Assign(ctx context.Context, volunteerID string, stopIDs []int) ([]int, error) {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var existing []struct {
+		StopID      int    `db:"stop_id"`
+		VolunteerID string `db:"volunteer_id"`
+	}
+	err = tx.SelectContext(ctx, &existing, `
+		SELECT stop_id, volunteer_id::text AS volunteer_id FROM assignments
+		WHERE stop_id = ANY($1) FOR UPDATE`, pq.Array(stopIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[int]bool, len(existing))
+	for _, e := range existing {
+		if e.VolunteerID != volunteerID {
+			return nil, fmt.Errorf("stop %d: %w", e.StopID, ErrStopAlreadyAssigned)
+		}
+		held[e.StopID] = true
+	}
+
+	var fresh []int
+	for _, id := range stopIDs {
+		if !held[id] {
+			fresh = append(fresh, id)
+			held[id] = true
+		}
+	}
+	if len(fresh) == 0 {
+		return nil, tx.Commit()
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO assignments (volunteer_id, stop_id)
+		SELECT $1, unnest($2::int[])`, volunteerID, pq.Array(fresh))
+	if err != nil {
+		return nil, mapAssignmentError(err)
+	}
+	return fresh, tx.Commit()
+}
+
+// Unassign removes the given stops from a volunteer, or all of their stops when
+// stopIDs is nil. It returns the stop IDs that were actually removed.
+func (r *AssignmentRepository) Unassign(ctx context.Context, volunteerID string, stopIDs []int) ([]int, error) {
+	var removed []int
+	var err error
+	if stopIDs == nil {
+		err = r.DB.SelectContext(ctx, &removed, `
+			DELETE FROM assignments WHERE volunteer_id = $1 RETURNING stop_id`, volunteerID)
+	} else {
+		err = r.DB.SelectContext(ctx, &removed, `
+			DELETE FROM assignments WHERE volunteer_id = $1 AND stop_id = ANY($2)
+			RETURNING stop_id`, volunteerID, pq.Array(stopIDs))
+	}
+	return removed, err
+}
+
+// Reassign moves stops from one volunteer to another, or all of the first
+// volunteer's stops when stopIDs is nil. It returns the moved stop IDs.
+func (r *AssignmentRepository) Reassign(ctx context.Context, fromID, toID string, stopIDs []int) ([]int, error) {
+	var moved []int
+	var err error
+	if stopIDs == nil {
+		err = r.DB.SelectContext(ctx, &moved, `
+			UPDATE assignments SET volunteer_id = $2, assigned_at = NOW()
+			WHERE volunteer_id = $1 RETURNING stop_id`, fromID, toID)
+	} else {
+		err = r.DB.SelectContext(ctx, &moved, `
+			UPDATE assignments SET volunteer_id = $2, assigned_at = NOW()
+			WHERE volunteer_id = $1 AND stop_id = ANY($3) RETURNING stop_id`,
+			fromID, toID, pq.Array(stopIDs))
+	}
+	return moved, err
+}
+
+// ListAssignments returns assignments filtered by volunteer and/or area (or
+// turf); empty filters match everything.
+func (r *AssignmentRepository) ListAssignments(ctx context.Context, volunteerID string, areaID int) ([]Assignment, error) {
+	var out []Assignment
+	query := `
+	SELECT ` + assignmentColumns + `
+	FROM assignments a JOIN stops s ON s.id = a.stop_id
+	WHERE ($1 = '' OR a.volunteer_id::text = $1)
+	  AND ($2 = 0 OR s.area_id = $2 OR s.turf_id = $2)
+	ORDER BY a.volunteer_id, s.area_id, a.stop_id`
+	err := r.DB.SelectContext(ctx, &out, query, volunteerID, areaID)
+	return out, err
+}
+
+// ListForVolunteerFrom returns a volunteer's assignments ordered by distance
+// from the given point.
+func (r *AssignmentRepository) ListForVolunteerFrom(ctx context.Context, volunteerID string, lat, lng float64) ([]Assignment, error) {
+	var out []Assignment
+	query := `
+	SELECT ` + assignmentColumns + `,
+	       ST_Distance(s.location, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography) AS distance
+	FROM assignments a JOIN stops s ON s.id = a.stop_id
+	WHERE a.volunteer_id = $1
+	ORDER BY distance, a.stop_id`
+	err := r.DB.SelectContext(ctx, &out, query, volunteerID, lng, lat)
+	return out, err
+}
+
+// ListPending returns a volunteer's stops that they have not yet recorded a
+// result for since the stop was assigned to them.
+func (r *AssignmentRepository) ListPending(ctx context.Context, volunteerID string) ([]Assignment, error) {
+	var out []Assignment
+	query := `
+	SELECT ` + assignmentColumns + `
+	FROM assignments a JOIN stops s ON s.id = a.stop_id
+	WHERE a.volunteer_id = $1
+	  AND NOT EXISTS (
+	      SELECT 1 FROM canvass_results r
+	      WHERE r.stop_id = a.stop_id AND r.volunteer_id = a.volunteer_id
+	        AND r.recorded_at >= a.assigned_at)
+	ORDER BY a.stop_id`
+	err := r.DB.SelectContext(ctx, &out, query, volunteerID)
+	return out, err
+}
+
+// PublishEvent notifies a volunteer's live connections of an assignment change.
+func (r *AssignmentRepository) PublishEvent(ctx context.Context, volunteerID string, ev AssignmentEvent) error {
+	return r.Publish(ctx, volunteerID, ev)
+}
+
+// Publish sends any JSON message to a volunteer's assignment channel.
+func (r *AssignmentRepository) Publish(ctx context.Context, volunteerID string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.Redis.Publish(ctx, AssignmentChannel(volunteerID), string(data)).Err()
+}
+
+// LockDispatch claims the next automatic dispatch round for ttl; it returns
+// false if another instance already has it.
+func (r *AssignmentRepository) LockDispatch(ctx context.Context, ttl time.Duration) (bool, error) {
+	return r.Redis.SetNX(ctx, dispatchLockKey, time.Now().UTC().Format(time.RFC3339), ttl).Result()
+}
+
+func mapAssignmentError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23503": // foreign_key_violation
+			return ErrStopNotFound
+		case "23505": // unique_violation
+			return ErrStopAlreadyAssigned
+		}
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Door-knock outcomes; these mirror the CHECK constraint on canvass_results.outcome.
+const (
+	OutcomeNotHome      = "not_home"
+	OutcomeRefused      = "refused"
+	OutcomeContacted    = "contacted"
+	OutcomeMoved        = "moved"
+	OutcomeInaccessible = "inaccessible"
+)
+
+var Outcomes = []string{OutcomeNotHome, OutcomeRefused, OutcomeContacted, OutcomeMoved, OutcomeInaccessible}
+
+var ErrStopNotAssigned = errors.New("stop is not assigned to you")
+
+type CanvassRepository struct {
+	DB *sqlx.DB
+}
+
+type CanvassResult struct {
+	ID          int       `db:"id" json:"id"`
+	StopID      int       `db:"stop_id" json:"stopId"`
+	VolunteerID string    `db:"volunteer_id" json:"volunteerId"`
+	Outcome     string    `db:"outcome" json:"outcome"`
+	Notes       string    `db:"notes" json:"notes"`
+	RecordedAt  time.Time `db:"recorded_at" json:"recordedAt"`
+}
+
+// OutcomeSummary counts results by outcome. StopsTotal is only filled for areas.
+type OutcomeSummary struct {
+	Results      int            `json:"results"`
+	StopsVisited int            `json:"stopsVisited"`
+	StopsTotal   int            `json:"stopsTotal,omitempty"`
+	ByOutcome    map[string]int `json:"byOutcome"`
+}
+
+// RecordResult stores an outcome, but only if the stop is assigned to the
+// volunteer; otherwise it returns ErrStopNotAssigned.
+func (r *CanvassRepository) RecordResult(ctx context.Context, res CanvassResult) (CanvassResult, error) {
+	var out CanvassResult
+	query := `
+	INSERT INTO canvass_results (stop_id, volunteer_id, outcome, notes)
+	SELECT a.stop_id, a.volunteer_id, $3, NULLIF($4, '')
+	FROM assignments a
+	WHERE a.stop_id = $1 AND a.volunteer_id = $2
+	RETURNING id, stop_id, volunteer_id, outcome, COALESCE(notes, '') AS notes, recorded_at`
+	err := r.DB.GetContext(ctx, &out, query, res.StopID, res.VolunteerID, res.Outcome, res.Notes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, ErrStopNotAssigned
+	}
+	return out, err
+}
+
+func (r *CanvassRepository) AreaSummary(ctx context.Context, areaID int) (OutcomeSummary, error) {
+	sum, err := r.summarize(ctx, `
+		SELECT r.outcome, COUNT(*) AS n
+		FROM canvass_results r JOIN stops s ON s.id = r.stop_id
+		WHERE s.area_id = $1 OR s.turf_id = $1
+		GROUP BY r.outcome`, `
+		SELECT COUNT(DISTINCT r.stop_id)
+		FROM canvass_results r JOIN stops s ON s.id = r.stop_id
+		WHERE s.area_id = $1 OR s.turf_id = $1`, areaID)
+	if err != nil {
+		return sum, err
+	}
+	err = r.DB.GetContext(ctx, &sum.StopsTotal, `SELECT COUNT(*) FROM stops WHERE area_id = $1 OR turf_id = $1`, areaID)
+	return sum, err
+}
+
+func (r *CanvassRepository) VolunteerSummary(ctx context.Context, volunteerID string) (OutcomeSummary, error) {
+	return r.summarize(ctx, `
+		SELECT outcome, COUNT(*) AS n
+		FROM canvass_results
+		WHERE volunteer_id = $1
+		GROUP BY outcome`, `
+		SELECT COUNT(DISTINCT stop_id) FROM canvass_results WHERE volunteer_id = $1`, volunteerID)
+}
+
+func (r *CanvassRepository) summarize(ctx context.Context, byOutcomeQuery, visitedQuery string, arg interface{}) (OutcomeSummary, error) {
+	sum := OutcomeSummary{ByOutcome: make(map[string]int, len(Outcomes))}
+	for _, o := range Outcomes {
+		sum.ByOutcome[o] = 0
+	}
+
+	var rows []struct {
+		Outcome string `db:"outcome"`
+		N       int    `db:"n"`
+	}
+	if err := r.DB.SelectContext(ctx, &rows, byOutcomeQuery, arg); err != nil {
+		return sum, err
+	}
+	for _, row := range rows {
+		sum.ByOutcome[row.Outcome] = row.N
+		sum.Results += row.N
+	}
+
+	err := r.DB.GetContext(ctx, &sum.StopsVisited, visitedQuery, arg)
+	return sum, err
+}
+
+// CountResults counts the doors a volunteer knocked in a time window.
+func (r *CanvassRepository) CountResults(ctx context.Context, volunteerID string, from, to time.Time) (int, error) {
+	var n int
+	err := r.DB.GetContext(ctx, &n, `
+		SELECT COUNT(*) FROM canvass_results
+		WHERE volunteer_id = $1 AND recorded_at BETWEEN $2::timestamptz AND $3::timestamptz`, volunteerID, from, to)
+	return n, err
+}
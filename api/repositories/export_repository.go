@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ExportRepository streams rows for bulk exports one at a time, so an export
+// never holds a whole table in memory.
+type ExportRepository struct {
+	DB *sqlx.DB
+}
+
+// ExportFilter narrows an export; a zero AreaID or empty VolunteerID matches
+// everything. Positions and tracks match an area by its polygon, results by
+// the stop's area or turf.
+type ExportFilter struct {
+	AreaID      int
+	VolunteerID string
+	From, To    time.Time
+}
+
+// ExportRow is one exported point: a latest position, a track fix or a
+// canvass result at its stop.
+type ExportRow struct {
+	VolunteerID string    `db:"volunteer_id"`
+	FullName    string    `db:"full_name"`
+	Lat         float64   `db:"lat"`
+	Lng         float64   `db:"lng"`
+	Time        time.Time `db:"time"`
+	Accuracy    *float64  `db:"accuracy"`
+	Altitude    *float64  `db:"altitude"`
+	Heading     *float64  `db:"heading"`
+	Speed       *float64  `db:"speed"`
+	Battery     *float64  `db:"battery"`
+	ResultID    int       `db:"result_id"`
+	StopID      int       `db:"stop_id"`
+	StopName    string    `db:"stop_name"`
+	AreaID      int       `db:"area_id"`
+	Outcome     string    `db:"outcome"`
+	Notes       string    `db:"notes"`
+}
+
+// StreamPositions calls fn with each volunteer's latest position updated in
+// the window.
+func (r *ExportRepository) StreamPositions(ctx context.Context, f ExportFilter, fn func(ExportRow) error) error {
+	return r.stream(ctx, fn, `
+		SELECT p.volunteer_id::text AS volunteer_id, COALESCE(p.full_name, '') AS full_name,
+		       ST_Y(p.position::geometry) AS lat, ST_X(p.position::geometry) AS lng,
+		       p.updated_at AS time, p.accuracy, p.altitude, p.heading, p.speed, p.battery
+		FROM volunteer_positions p
+		LEFT JOIN areas ar ON ar.id = $1
+		WHERE ($1 = 0 OR ST_Covers(ar.polygon, p.position))
+		  AND ($2 = '' OR p.volunteer_id::text = $2)
+		  AND p.updated_at BETWEEN $3::timestamptz AND $4::timestamptz
+		ORDER BY p.volunteer_id`, f.AreaID, f.VolunteerID, f.From, f.To)
+}
+
+// StreamTrack calls fn with every unflagged fix in the window, grouped by
+// volunteer and in time order within each.
+func (r *ExportRepository) StreamTrack(ctx context.Context, f ExportFilter, fn func(ExportRow) error) error {
+	return r.stream(ctx, fn, `
+		SELECT h.volunteer_id::text AS volunteer_id, COALESCE(p.full_name, '') AS full_name,
+		       ST_Y(h.position::geometry) AS lat, ST_X(h.position::geometry) AS lng,
+		       h.recorded_at AS time, h.accuracy, h.altitude, h.heading, h.speed, h.battery
+		FROM volunteer_position_history h
+		LEFT JOIN volunteer_positions p ON p.volunteer_id = h.volunteer_id
+		LEFT JOIN areas ar ON ar.id = $1
+		WHERE ($1 = 0 OR ST_Covers(ar.polygon, h.position))
+		  AND ($2 = '' OR h.volunteer_id::text = $2)
+		  AND h.recorded_at BETWEEN $3 AND $4
+		  AND h.flag IS NULL
+		ORDER BY h.volunteer_id, h.recorded_at, h.id`, f.AreaID, f.VolunteerID, f.From, f.To)
+}
+
+// StreamResults calls fn with every canvass result recorded in the window,
+// placed at its stop.
+func (r *ExportRepository) StreamResults(ctx context.Context, f ExportFilter, fn func(ExportRow) error) error {
+	return r.stream(ctx, fn, `
+		SELECT r.id AS result_id, r.stop_id, COALESCE(s.name, '') AS stop_name, s.area_id,
+		       r.volunteer_id::text AS volunteer_id, COALESCE(p.full_name, '') AS full_name,
+		       ST_Y(s.location::geometry) AS lat, ST_X(s.location::geometry) AS lng,
+		       r.recorded_at AS time, r.outcome, COALESCE(r.notes, '') AS notes
+		FROM canvass_results r
+		JOIN stops s ON s.id = r.stop_id
+		LEFT JOIN volunteer_positions p ON p.volunteer_id = r.volunteer_id
+		WHERE ($1 = 0 OR s.area_id = $1 OR s.turf_id = $1)
+		  AND ($2 = '' OR r.volunteer_id::text = $2)
+		  AND r.recorded_at BETWEEN $3::timestamptz AND $4::timestamptz
+		ORDER BY r.recorded_at, r.id`, f.AreaID, f.VolunteerID, f.From, f.To)
+}
+
+func (r *ExportRepository) stream(ctx context.Context, fn func(ExportRow) error, query string, args ...interface{}) error {
+	rows, err := r.DB.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var row ExportRow
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
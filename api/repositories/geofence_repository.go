@@ -0,0 +1,224 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+// GeofenceChannel carries out-of-turf alerts, separate from the position feed.
+const GeofenceChannel = "geofence"
+
+// Geofence event types published on GeofenceChannel.
+const (
+	GeofenceExited  = "geofence.exited"
+	GeofenceCleared = "geofence.cleared"
+)
+
+type GeofenceRepository struct {
+	DB    *sqlx.DB
+	Redis *redis.Client
+}
+
+type GeofenceAlert struct {
+	Type           string     `db:"-" json:"type,omitempty"`
+	ID             int        `db:"id" json:"id"`
+	VolunteerID    string     `db:"volunteer_id" json:"volunteerId"`
+	FullName       string     `db:"full_name" json:"fullName"`
+	AreaID         *int       `db:"area_id" json:"areaId"`
+	Lat            float64    `db:"lat" json:"lat"`
+	Lng            float64    `db:"lng" json:"lng"`
+	DistanceMeters float64    `db:"distance_meters" json:"distanceMeters"`
+	OutsideSince   time.Time  `db:"outside_since" json:"outsideSince"`
+	RaisedAt       time.Time  `db:"raised_at" json:"raisedAt"`
+	ClearedAt      *time.Time `db:"cleared_at" json:"clearedAt"`
+}
+
+// TurfCheck describes a position relative to the volunteer's assigned areas.
+type TurfCheck struct {
+	Assigned       bool    // volunteer has at least one assigned stop
+	Inside         bool    // within the buffer of some assigned area
+	NearestAreaID  int     // closest assigned area
+	DistanceMeters float64 // distance to that area's polygon
+}
+
+const geofenceAlertColumns = `id, volunteer_id, COALESCE(full_name, '') AS full_name, area_id,
+	ST_Y(position::geometry) AS lat, ST_X(position::geometry) AS lng,
+	distance_meters, outside_since, raised_at, cleared_at`
+
+// CheckTurf measures a point against every area the volunteer has stops in,
+// using a stop's turf rather than the area it was cut from.
+func (r *GeofenceRepository) CheckTurf(ctx context.Context, volunteerID string, lat, lng, buffer float64) (TurfCheck, error) {
+	var row struct {
+		AreaID   int     `db:"area_id"`
+		Distance float64 `db:"distance"`
+	}
+	query := `
+	SELECT ar.id AS area_id,
+	       ST_Distance(ar.polygon, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography) AS distance
+	FROM areas ar
+	WHERE ar.polygon IS NOT NULL
+	  AND EXISTS (SELECT 1 FROM assignments a JOIN stops s ON s.id = a.stop_id
+	              WHERE a.volunteer_id = $1 AND COALESCE(s.turf_id, s.area_id) = ar.id)
+	ORDER BY distance
+	LIMIT 1`
+	err := r.DB.GetContext(ctx, &row, query, volunteerID, lng, lat)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TurfCheck{}, nil
+	}
+	if err != nil {
+		return TurfCheck{}, err
+	}
+	return TurfCheck{
+		Assigned:       true,
+		Inside:         row.Distance <= buffer,
+		NearestAreaID:  row.AreaID,
+		DistanceMeters: row.Distance,
+	}, nil
+}
+
+func outsideKey(volunteerID string) string {
+	return fmt.Sprintf("geofence:outside:%s", volunteerID)
+}
+
+func outsideFixKey(volunteerID string) string {
+	return fmt.Sprintf("geofence:outside:fix:%s", volunteerID)
+}
+
+// outsidePendingKey scores each volunteer seen outside, and not yet alerted,
+// by the unix time they left, so silent volunteers can be checked on a timer.
+const outsidePendingKey = "geofence:outside:pending"
+
+// MarkOutside records when the volunteer was first seen outside their turf and
+// returns that instant; later calls keep the original timestamp but replace
+// the last fix seen outside.
+func (r *GeofenceRepository) MarkOutside(ctx context.Context, pos Position, now time.Time) (time.Time, error) {
+	key := outsideKey(pos.ID)
+	if err := r.Redis.SetNX(ctx, key, now.Format(time.RFC3339Nano), 24*time.Hour).Err(); err != nil {
+		return now, err
+	}
+	v, err := r.Redis.Get(ctx, key).Result()
+	if err != nil {
+		return now, err
+	}
+	since, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return now, err
+	}
+
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return since, err
+	}
+	pipe := r.Redis.TxPipeline()
+	pipe.Set(ctx, outsideFixKey(pos.ID), data, 24*time.Hour)
+	pipe.ZAddNX(ctx, outsidePendingKey, &redis.Z{Score: float64(since.Unix()), Member: pos.ID})
+	_, err = pipe.Exec(ctx)
+	return since, err
+}
+
+// DueOutside lists volunteers pending since before cutoff.
+func (r *GeofenceRepository) DueOutside(ctx context.Context, cutoff time.Time) ([]string, error) {
+	return r.Redis.ZRangeByScore(ctx, outsidePendingKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(cutoff.Unix(), 10),
+	}).Result()
+}
+
+// OutsideFix returns the last fix seen outside and when the volunteer left;
+// redis.Nil once either has expired.
+func (r *GeofenceRepository) OutsideFix(ctx context.Context, volunteerID string) (Position, time.Time, error) {
+	var pos Position
+	v, err := r.Redis.Get(ctx, outsideKey(volunteerID)).Result()
+	if err != nil {
+		return pos, time.Time{}, err
+	}
+	since, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return pos, since, err
+	}
+	data, err := r.Redis.Get(ctx, outsideFixKey(volunteerID)).Bytes()
+	if err != nil {
+		return pos, since, err
+	}
+	err = json.Unmarshal(data, &pos)
+	return pos, since, err
+}
+
+// DoneOutside stops the timer from checking the volunteer until their next
+// fix outside.
+func (r *GeofenceRepository) DoneOutside(ctx context.Context, volunteerID string) error {
+	return r.Redis.ZRem(ctx, outsidePendingKey, volunteerID).Err()
+}
+
+func (r *GeofenceRepository) ClearOutside(ctx context.Context, volunteerID string) error {
+	pipe := r.Redis.TxPipeline()
+	pipe.Del(ctx, outsideKey(volunteerID), outsideFixKey(volunteerID))
+	pipe.ZRem(ctx, outsidePendingKey, volunteerID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// OpenAlert persists an alert unless the volunteer already has an open one.
+// The boolean reports whether a new alert was created.
+func (r *GeofenceRepository) OpenAlert(ctx context.Context, a GeofenceAlert) (GeofenceAlert, bool, error) {
+	var out GeofenceAlert
+	query := `
+	INSERT INTO geofence_alerts (volunteer_id, full_name, area_id, position, distance_meters, outside_since)
+	VALUES ($1, $2, $3, ST_SetSRID(ST_MakePoint($4, $5), 4326)::geography, $6, $7)
+	ON CONFLICT (volunteer_id) WHERE cleared_at IS NULL DO NOTHING
+	RETURNING ` + geofenceAlertColumns
+	err := r.DB.GetContext(ctx, &out, query,
+		a.VolunteerID, a.FullName, a.AreaID, a.Lng, a.Lat, a.DistanceMeters, a.OutsideSince)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, false, nil
+	}
+	return out, err == nil, err
+}
+
+// ClearAlert closes the volunteer's open alert, if any.
+func (r *GeofenceRepository) ClearAlert(ctx context.Context, volunteerID string) (GeofenceAlert, bool, error) {
+	var out GeofenceAlert
+	query := `
+	UPDATE geofence_alerts SET cleared_at = NOW()
+	WHERE volunteer_id = $1 AND cleared_at IS NULL
+	RETURNING ` + geofenceAlertColumns
+	err := r.DB.GetContext(ctx, &out, query, volunteerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, false, nil
+	}
+	return out, err == nil, err
+}
+
+// ListAlerts returns recent alerts, newest first; openOnly limits to uncleared ones.
+func (r *GeofenceRepository) ListAlerts(ctx context.Context, openOnly bool, limit int) ([]GeofenceAlert, error) {
+	var out []GeofenceAlert
+	query := `
+	SELECT ` + geofenceAlertColumns + `
+	FROM geofence_alerts
+	WHERE NOT $1 OR cleared_at IS NULL
+	ORDER BY raised_at DESC
+	LIMIT $2`
+	err := r.DB.SelectContext(ctx, &out, query, openOnly, limit)
+	return out, err
+}
+
+// Publish puts the alert on the admin live feed and on GeofenceChannel for
+// any other listeners.
+func (r *GeofenceRepository) Publish(ctx context.Context, a GeofenceAlert) error {
+	if _, err := appendStreamEvent(ctx, r.Redis, a.Type, a); err != nil {
+		return err
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	return r.Redis.Publish(ctx, GeofenceChannel, string(data)).Err()
+}
@@ -0,0 +1,37 @@
+package repositories
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// GeoJSON holds a raw GeoJSON geometry, as produced by ST_AsGeoJSON and
+// consumed by ST_GeomFromGeoJSON. It scans from text columns and is emitted
+// verbatim in API responses.
+type GeoJSON json.RawMessage
+
+func (g *GeoJSON) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*g = nil
+	case []byte:
+		*g = append((*g)[0:0], v...)
+	case string:
+		*g = GeoJSON(v)
+	default:
+		return fmt.Errorf("cannot scan %T into GeoJSON", src)
+	}
+	return nil
+}
+
+func (g GeoJSON) MarshalJSON() ([]byte, error) {
+	if len(g) == 0 {
+		return []byte("null"), nil
+	}
+	return g, nil
+}
+
+func (g *GeoJSON) UnmarshalJSON(b []byte) error {
+	*g = append((*g)[0:0], b...)
+	return nil
+}
@@ -0,0 +1,149 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// The admin live feed is a Redis Stream rather than pub/sub so a client that
+// drops off can replay what it missed. Entry IDs are "<seq>-0", where seq is a
+// counter shared by every API instance.
+const (
+	PositionStream       = "stream:positions"
+	positionStreamSeq    = "stream:positions:seq"
+	PositionStreamMaxLen = 50000 // approximate; older entries are trimmed
+)
+
+// StreamEvent is one entry of the admin live feed.
+type StreamEvent struct {
+	Seq  int64           `json:"seq"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// appendScript allocates the next sequence number and appends the entry in
+// one step, so entries land in the stream in sequence order. If the counter
+// was lost it resumes after the newest entry rather than failing.
+var appendScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[2])
+local last = redis.call('XREVRANGE', KEYS[1], '+', '-', 'COUNT', 1)
+if #last > 0 then
+  local lastSeq = tonumber(string.match(last[1][1], '^(%d+)'))
+  if lastSeq >= seq then
+    seq = lastSeq + 1
+    redis.call('SET', KEYS[2], seq)
+  end
+end
+redis.call('XADD', KEYS[1], 'MAXLEN', '~', ARGV[1], seq .. '-0', 'type', ARGV[2], 'data', ARGV[3])
+return seq`)
+
+func appendStreamEvent(ctx context.Context, rdb *redis.Client, eventType string, v interface{}) (int64, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0, err
+	}
+	return appendScript.Run(ctx, rdb, []string{PositionStream, positionStreamSeq},
+		PositionStreamMaxLen, eventType, string(data)).Int64()
+}
+
+// AppendEvent adds an event to the admin live feed and returns its sequence number.
+func (r *VolunteerRepository) AppendEvent(ctx context.Context, eventType string, v interface{}) (int64, error) {
+	return appendStreamEvent(ctx, r.Redis, eventType, v)
+}
+
+// ReadEvents returns events with a sequence number greater than after,
+// waiting up to block for new ones. A zero block returns immediately.
+func (r *VolunteerRepository) ReadEvents(ctx context.Context, after int64, count int64, block time.Duration) ([]StreamEvent, error) {
+	if block <= 0 {
+		msgs, err := r.Redis.XRangeN(ctx, PositionStream, "("+streamID(after), "+", count).Result()
+		if err != nil {
+			return nil, err
+		}
+		return toStreamEvents(msgs), nil
+	}
+
+	streams, err := r.Redis.XRead(ctx, &redis.XReadArgs{
+		Streams: []string{PositionStream, streamID(after)},
+		Count:   count,
+		Block:   block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var events []StreamEvent
+	for _, s := range streams {
+		events = append(events, toStreamEvents(s.Messages)...)
+	}
+	return events, nil
+}
+
+// StreamBounds returns the oldest and newest sequence numbers still held in
+// the feed; both are zero when it is empty.
+func (r *VolunteerRepository) StreamBounds(ctx context.Context) (oldest, newest int64, err error) {
+	first, err := r.Redis.XRangeN(ctx, PositionStream, "-", "+", 1).Result()
+	if err != nil || len(first) == 0 {
+		return 0, 0, err
+	}
+	last, err := r.Redis.XRevRangeN(ctx, PositionStream, "+", "-", 1).Result()
+	if err != nil || len(last) == 0 {
+		return 0, 0, err
+	}
+	return parseSeq(first[0].ID), parseSeq(last[0].ID), nil
+}
+
+// GetLivePositions returns every position still cached in Redis.
+func (r *VolunteerRepository) GetLivePositions(ctx context.Context) ([]Position, error) {
+	var keys []string
+	iter := r.Redis.Scan(ctx, 0, "position:*", 500).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil || len(keys) == 0 {
+		return nil, err
+	}
+
+	vals, err := r.Redis.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	positions := make([]Position, 0, len(vals))
+	for _, v := range vals {
+		s, ok := v.(string)
+		if !ok {
+			continue // expired between SCAN and MGET
+		}
+		var p Position
+		if err := json.Unmarshal([]byte(s), &p); err == nil {
+			positions = append(positions, p)
+		}
+	}
+	return positions, nil
+}
+
+func streamID(seq int64) string {
+	return strconv.FormatInt(seq, 10) + "-0"
+}
+
+func parseSeq(id string) int64 {
+	n, _ := strconv.ParseInt(strings.SplitN(id, "-", 2)[0], 10, 64)
+	return n
+}
+
+func toStreamEvents(msgs []redis.XMessage) []StreamEvent {
+	events := make([]StreamEvent, 0, len(msgs))
+	for _, m := range msgs {
+		typ, _ := m.Values["type"].(string)
+		data, _ := m.Values["data"].(string)
+		events = append(events, StreamEvent{Seq: parseSeq(m.ID), Type: typ, Data: json.RawMessage(data)})
+	}
+	return events
+}
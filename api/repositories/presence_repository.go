@@ -0,0 +1,122 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Presence states, from most to least present.
+const (
+	PresenceActive  = "active"  // reporting and moving
+	PresenceIdle    = "idle"    // reporting but hasn't moved for a while
+	PresenceStale   = "stale"   // no fix for a few minutes
+	PresenceOffline = "offline" // gone quiet; probably went home
+)
+
+// EventPresenceChanged is appended to the admin feed on every status transition.
+const EventPresenceChanged = "presence.changed"
+
+// presenceKey is a hash of volunteer ID to PresenceRecord JSON.
+const presenceKey = "presence"
+
+type PresenceRepository struct {
+	Redis *redis.Client
+}
+
+// PresenceRecord is the state kept per volunteer. The anchor is where they
+// were when they last moved; idle is measured from MovedAt.
+type PresenceRecord struct {
+	VolunteerID string    `json:"volunteerId"`
+	FullName    string    `json:"fullName"`
+	Status      string    `json:"status"`
+	Since       time.Time `json:"since"` // when Status was entered
+	LastSeen    time.Time `json:"lastSeen"`
+	MovedAt     time.Time `json:"movedAt"`
+	Lat         float64   `json:"lat"`
+	Lng         float64   `json:"lng"`
+	AnchorLat   float64   `json:"anchorLat"`
+	AnchorLng   float64   `json:"anchorLng"`
+}
+
+// PresenceChange is the payload of EventPresenceChanged.
+type PresenceChange struct {
+	VolunteerID string    `json:"volunteerId"`
+	FullName    string    `json:"fullName"`
+	Status      string    `json:"status"`
+	Previous    string    `json:"previous,omitempty"`
+	LastSeen    time.Time `json:"lastSeen"`
+	Lat         float64   `json:"lat"`
+	Lng         float64   `json:"lng"`
+}
+
+// casScript replaces a record only if it still holds the value the caller
+// read, so the sweeper never overwrites a fix that arrived meanwhile and
+// every transition is published by exactly one instance. An empty new value
+// deletes the record.
+var casScript = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], ARGV[1])
+if (cur or '') ~= ARGV[2] then return 0 end
+if ARGV[3] == '' then
+  redis.call('HDEL', KEYS[1], ARGV[1])
+else
+  redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+end
+return 1`)
+
+// Get returns a volunteer's record and the raw value to pass to
+// CompareAndSwap; a volunteer never seen has a nil record and empty raw value.
+func (r *PresenceRepository) Get(ctx context.Context, volunteerID string) (*PresenceRecord, string, error) {
+	raw, err := r.Redis.HGet(ctx, presenceKey, volunteerID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	var rec PresenceRecord
+	if err := json.Unmarshal([]byte(raw), &rec); err != nil {
+		return nil, "", err
+	}
+	return &rec, raw, nil
+}
+
+// List returns every record keyed by volunteer ID, with the raw values.
+func (r *PresenceRepository) List(ctx context.Context) (map[string]PresenceRecord, map[string]string, error) {
+	all, err := r.Redis.HGetAll(ctx, presenceKey).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	recs := make(map[string]PresenceRecord, len(all))
+	for id, raw := range all {
+		var rec PresenceRecord
+		if json.Unmarshal([]byte(raw), &rec) == nil {
+			recs[id] = rec
+		}
+	}
+	return recs, all, nil
+}
+
+// CompareAndSwap stores rec (or deletes the record when rec is nil) if the
+// stored value still equals old, reporting whether it did.
+func (r *PresenceRepository) CompareAndSwap(ctx context.Context, volunteerID, old string, rec *PresenceRecord) (bool, error) {
+	next := ""
+	if rec != nil {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			return false, err
+		}
+		next = string(data)
+	}
+	n, err := casScript.Run(ctx, r.Redis, []string{presenceKey}, volunteerID, old, next).Int()
+	return n == 1, err
+}
+
+// Publish appends a status transition to the admin live feed.
+func (r *PresenceRepository) Publish(ctx context.Context, c PresenceChange) error {
+	_, err := appendStreamEvent(ctx, r.Redis, EventPresenceChanged, c)
+	return err
+}
@@ -0,0 +1,133 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+// EventPrivacyChanged is appended to the admin feed when a volunteer changes
+// how their location is shared.
+const EventPrivacyChanged = "privacy.changed"
+
+// Sharing restrictions reported to admins; none means sharing normally.
+const (
+	SharingPaused    = "paused"
+	SharingShiftOnly = "shift_only"
+	SharingCoarse    = "coarse"
+)
+
+type PrivacyRepository struct {
+	DB    *sqlx.DB
+	Redis *redis.Client
+}
+
+// PrivacySettings are a volunteer's own choices about location sharing.
+type PrivacySettings struct {
+	VolunteerID  string    `db:"volunteer_id" json:"volunteerId"`
+	FullName     string    `db:"full_name" json:"fullName"`
+	Paused       bool      `db:"paused" json:"paused"`
+	ShiftOnly    bool      `db:"shift_only" json:"shiftOnly"`
+	CoarseMeters int       `db:"coarse_meters" json:"coarseMeters"` // 0 shares full precision
+	UpdatedAt    time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// Sharing lists every restriction in effect, most restrictive first; it is
+// empty when sharing normally.
+func (p PrivacySettings) Sharing() []string {
+	modes := []string{}
+	if p.Paused {
+		modes = append(modes, SharingPaused)
+	}
+	if p.ShiftOnly {
+		modes = append(modes, SharingShiftOnly)
+	}
+	if p.CoarseMeters > 0 {
+		modes = append(modes, SharingCoarse)
+	}
+	return modes
+}
+
+// PrivacyChange is the payload of EventPrivacyChanged.
+type PrivacyChange struct {
+	VolunteerID string   `json:"volunteerId"`
+	FullName    string   `json:"fullName"`
+	Sharing     []string `json:"sharing"`
+}
+
+// Settings are cached in Redis, defaults included, since every position
+// update consults them.
+func privacyKey(volunteerID string) string {
+	return fmt.Sprintf("privacy:%s", volunteerID)
+}
+
+const privacyColumns = `volunteer_id, COALESCE(full_name, '') AS full_name, paused, shift_only, coarse_meters, updated_at`
+
+// Get returns a volunteer's settings; a volunteer who never set any gets
+// the zero value (share normally).
+func (r *PrivacyRepository) Get(ctx context.Context, volunteerID string) (PrivacySettings, error) {
+	var p PrivacySettings
+	if data, err := r.Redis.Get(ctx, privacyKey(volunteerID)).Result(); err == nil {
+		if json.Unmarshal([]byte(data), &p) == nil {
+			return p, nil
+		}
+	}
+
+	err := r.DB.GetContext(ctx, &p, `SELECT `+privacyColumns+` FROM volunteer_privacy WHERE volunteer_id = $1`, volunteerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		p, err = PrivacySettings{VolunteerID: volunteerID}, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	r.cache(ctx, p)
+	return p, nil
+}
+
+func (r *PrivacyRepository) cache(ctx context.Context, p PrivacySettings) {
+	if data, err := json.Marshal(p); err == nil {
+		r.Redis.Set(ctx, privacyKey(p.VolunteerID), string(data), 0)
+	}
+}
+
+// Save stores a volunteer's settings and refreshes the cache.
+func (r *PrivacyRepository) Save(ctx context.Context, p PrivacySettings) (PrivacySettings, error) {
+	var out PrivacySettings
+	err := r.DB.GetContext(ctx, &out, `
+		INSERT INTO volunteer_privacy (volunteer_id, full_name, paused, shift_only, coarse_meters)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+		ON CONFLICT (volunteer_id) DO UPDATE
+		SET full_name = EXCLUDED.full_name,
+		    paused = EXCLUDED.paused,
+		    shift_only = EXCLUDED.shift_only,
+		    coarse_meters = EXCLUDED.coarse_meters,
+		    updated_at = now()
+		RETURNING `+privacyColumns, p.VolunteerID, p.FullName, p.Paused, p.ShiftOnly, p.CoarseMeters)
+	if err != nil {
+		return out, err
+	}
+	r.cache(ctx, out)
+	return out, nil
+}
+
+// ListRestricted returns every volunteer who limits sharing in some way.
+func (r *PrivacyRepository) ListRestricted(ctx context.Context) ([]PrivacySettings, error) {
+	var out []PrivacySettings
+	err := r.DB.SelectContext(ctx, &out, `
+		SELECT `+privacyColumns+` FROM volunteer_privacy
+		WHERE paused OR shift_only OR coarse_meters > 0
+		ORDER BY full_name`)
+	return out, err
+}
+
+// Publish appends a sharing change to the admin live feed.
+func (r *PrivacyRepository) Publish(ctx context.Context, c PrivacyChange) error {
+	_, err := appendStreamEvent(ctx, r.Redis, EventPrivacyChanged, c)
+	return err
+}
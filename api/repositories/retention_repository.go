@@ -0,0 +1,212 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+// retentionBatch bounds each DELETE so a large backlog never holds long locks.
+const retentionBatch = 10000
+
+// retentionLockKey makes sure only one API instance enforces retention per interval.
+const retentionLockKey = "retention:lock"
+
+type RetentionRepository struct {
+	DB    *sqlx.DB
+	Redis *redis.Client
+}
+
+// PurgeResult counts what a purge or retention pass removed.
+type PurgeResult struct {
+	History        int64 `json:"history"`
+	Downsampled    int64 `json:"downsampled"`
+	Latest         int64 `json:"latest"`
+	GeofenceAlerts int64 `json:"geofenceAlerts"`
+	SOSPositions   int64 `json:"sosPositions"`
+	StreamEntries  int64 `json:"streamEntries"`
+}
+
+// Lock takes the retention lock for ttl, reporting whether this caller got
+// it. The lock is left to expire, so a pass runs at most once per ttl.
+func (r *RetentionRepository) Lock(ctx context.Context, ttl time.Duration) (bool, error) {
+	return r.Redis.SetNX(ctx, retentionLockKey, time.Now().UTC().Format(time.RFC3339), ttl).Result()
+}
+
+// deleteBatched runs a DELETE whose WHERE clause selects ids via a LIMITed
+// subquery until nothing is left, returning the total removed.
+func (r *RetentionRepository) deleteBatched(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	var total int64
+	for {
+		res, err := r.DB.ExecContext(ctx, query, args...)
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < retentionBatch {
+			return total, nil
+		}
+	}
+}
+
+// DeleteHistoryBefore removes history fixes, flagged ones included, older than cutoff.
+func (r *RetentionRepository) DeleteHistoryBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return r.deleteBatched(ctx, fmt.Sprintf(`
+		DELETE FROM volunteer_position_history
+		WHERE id IN (SELECT id FROM volunteer_position_history WHERE recorded_at < $1 LIMIT %d)`,
+		retentionBatch), cutoff)
+}
+
+// DeleteFlaggedBefore removes fixes held for review older than cutoff.
+func (r *RetentionRepository) DeleteFlaggedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	return r.deleteBatched(ctx, fmt.Sprintf(`
+		DELETE FROM volunteer_position_history
+		WHERE id IN (SELECT id FROM volunteer_position_history
+		             WHERE flag IS NOT NULL AND recorded_at < $1 LIMIT %d)`,
+		retentionBatch), cutoff)
+}
+
+// Downsample thins history recorded between from and to down to the first
+// fix of each volunteer in every bucket. Re-running it is a no-op.
+func (r *RetentionRepository) Downsample(ctx context.Context, from, to time.Time, bucket time.Duration) (int64, error) {
+	return r.deleteBatched(ctx, fmt.Sprintf(`
+		DELETE FROM volunteer_position_history
+		WHERE id IN (
+			SELECT id FROM (
+				SELECT id, row_number() OVER (
+				           PARTITION BY volunteer_id, date_bin(make_interval(secs => $3), recorded_at, TIMESTAMPTZ 'epoch')
+				           ORDER BY recorded_at, id) AS rn
+				FROM volunteer_position_history
+				WHERE recorded_at >= $1 AND recorded_at < $2 AND flag IS NULL
+			) b
+			WHERE rn > 1
+			LIMIT %d)`, retentionBatch), from, to, bucket.Seconds())
+}
+
+// DeleteLatestBefore removes latest-position rows not updated since cutoff.
+func (r *RetentionRepository) DeleteLatestBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM volunteer_positions WHERE updated_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteClearedAlertsBefore removes closed geofence alerts, which hold a
+// position, raised before cutoff.
+func (r *RetentionRepository) DeleteClearedAlertsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		DELETE FROM geofence_alerts WHERE cleared_at IS NOT NULL AND raised_at < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ClearResolvedSOSBefore drops the position of incidents resolved before
+// cutoff; the incident itself and its notes are kept.
+func (r *RetentionRepository) ClearResolvedSOSBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	res, err := r.DB.ExecContext(ctx, `
+		UPDATE sos_incidents SET position = NULL, accuracy = NULL
+		WHERE status = 'resolved' AND resolved_at < $1 AND position IS NOT NULL`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// PurgeVolunteer removes every stored location of one volunteer: history,
+// latest position, geofence alerts, SOS incident positions, the live caches
+// and their entries in the admin feed.
+func (r *RetentionRepository) PurgeVolunteer(ctx context.Context, volunteerID string) (PurgeResult, error) {
+	var res PurgeResult
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return res, err
+	}
+	defer tx.Rollback()
+
+	for _, step := range []struct {
+		n     *int64
+		query string
+	}{
+		{&res.History, `DELETE FROM volunteer_position_history WHERE volunteer_id = $1`},
+		{&res.Latest, `DELETE FROM volunteer_positions WHERE volunteer_id = $1`},
+		{&res.GeofenceAlerts, `DELETE FROM geofence_alerts WHERE volunteer_id = $1`},
+		{&res.SOSPositions, `UPDATE sos_incidents SET position = NULL, accuracy = NULL
+		                     WHERE volunteer_id = $1 AND position IS NOT NULL`},
+	} {
+		out, err := tx.ExecContext(ctx, step.query, volunteerID)
+		if err != nil {
+			return res, err
+		}
+		if *step.n, err = out.RowsAffected(); err != nil {
+			return res, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return res, err
+	}
+
+	pipe := r.Redis.TxPipeline()
+	pipe.Del(ctx, fmt.Sprintf("position:%s", volunteerID), suspectKey(volunteerID), outsideKey(volunteerID), outsideFixKey(volunteerID))
+	pipe.ZRem(ctx, outsidePendingKey, volunteerID)
+	pipe.HDel(ctx, presenceKey, volunteerID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return res, err
+	}
+
+	res.StreamEntries, err = r.purgeStream(ctx, volunteerID)
+	return res, err
+}
+
+// purgeStream deletes the volunteer's entries from the admin feed. The feed
+// is capped at PositionStreamMaxLen, so a full scan stays bounded.
+func (r *RetentionRepository) purgeStream(ctx context.Context, volunteerID string) (int64, error) {
+	var purged int64
+	start := "-"
+	for {
+		msgs, err := r.Redis.XRangeN(ctx, PositionStream, start, "+", 1000).Result()
+		if err != nil {
+			return purged, err
+		}
+		var ids []string
+		for _, m := range msgs {
+			data, _ := m.Values["data"].(string)
+			// Positions carry the volunteer in "id"; alerts and presence
+			// changes in "volunteerId" (their "id" is numeric).
+			var p struct {
+				ID          json.RawMessage `json:"id"`
+				VolunteerID string          `json:"volunteerId"`
+			}
+			if json.Unmarshal([]byte(data), &p) != nil {
+				continue
+			}
+			var id string
+			json.Unmarshal(p.ID, &id)
+			if strings.EqualFold(id, volunteerID) || strings.EqualFold(p.VolunteerID, volunteerID) {
+				ids = append(ids, m.ID)
+			}
+		}
+		if len(ids) > 0 {
+			n, err := r.Redis.XDel(ctx, PositionStream, ids...).Result()
+			if err != nil {
+				return purged, err
+			}
+			purged += n
+		}
+		if len(msgs) < 1000 {
+			return purged, nil
+		}
+		start = "(" + msgs[len(msgs)-1].ID
+	}
+}
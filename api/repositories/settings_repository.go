@@ -0,0 +1,63 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type SettingsRepository struct {
+	DB *sqlx.DB
+}
+
+// PositionSettings overrides the position thresholds globally (AreaID nil)
+// or inside one area. Nil fields inherit from the next level up.
+type PositionSettings struct {
+	AreaID                   *int      `db:"area_id" json:"areaId"`
+	AreaName                 *string   `db:"area_name" json:"areaName,omitempty"`
+	Polygon                  GeoJSON   `db:"polygon" json:"-"`
+	MinDistanceMeters        *float64  `db:"min_distance_meters" json:"minDistanceMeters"`
+	MinUpdateIntervalSeconds *int      `db:"min_update_interval_seconds" json:"minUpdateIntervalSeconds"`
+	LiveTTLSeconds           *int      `db:"live_ttl_seconds" json:"liveTtlSeconds"`
+	UpdatedAt                time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// ListPositionSettings returns every override, the global row first and then
+// area rows from the smallest area up, so the most specific area wins.
+func (r *SettingsRepository) ListPositionSettings(ctx context.Context) ([]PositionSettings, error) {
+	var out []PositionSettings
+	err := r.DB.SelectContext(ctx, &out, `
+		SELECT s.area_id, a.name AS area_name, ST_AsGeoJSON(a.polygon) AS polygon,
+		       s.min_distance_meters, s.min_update_interval_seconds, s.live_ttl_seconds, s.updated_at
+		FROM position_settings s
+		LEFT JOIN areas a ON a.id = s.area_id
+		ORDER BY s.area_id IS NOT NULL, ST_Area(a.polygon), s.area_id`)
+	return out, err
+}
+
+// UpsertPositionSettings replaces the override for s.AreaID (nil for global).
+func (r *SettingsRepository) UpsertPositionSettings(ctx context.Context, s PositionSettings) error {
+	conflict := `(area_id)`
+	if s.AreaID == nil {
+		conflict = `((area_id IS NULL)) WHERE area_id IS NULL`
+	}
+	query := `
+	INSERT INTO position_settings (area_id, min_distance_meters, min_update_interval_seconds, live_ttl_seconds)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT ` + conflict + ` DO UPDATE
+	SET min_distance_meters = EXCLUDED.min_distance_meters,
+	    min_update_interval_seconds = EXCLUDED.min_update_interval_seconds,
+	    live_ttl_seconds = EXCLUDED.live_ttl_seconds,
+	    updated_at = now()`
+	_, err := r.DB.ExecContext(ctx, query, s.AreaID, s.MinDistanceMeters, s.MinUpdateIntervalSeconds, s.LiveTTLSeconds)
+	return err
+}
+
+// DeletePositionSettings drops an override so the level above applies again.
+func (r *SettingsRepository) DeletePositionSettings(ctx context.Context, areaID *int) error {
+	_, err := r.DB.ExecContext(ctx, `
+		DELETE FROM position_settings
+		WHERE area_id = $1 OR ($1 IS NULL AND area_id IS NULL)`, areaID)
+	return err
+}
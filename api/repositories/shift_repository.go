@@ -0,0 +1,166 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrNoOpenShift      = errors.New("no open shift; check in first")
+	ErrShiftAlreadyOpen = errors.New("a shift is already open; check out first")
+)
+
+type ShiftRepository struct {
+	DB    *sqlx.DB
+	Redis *redis.Client
+}
+
+type Shift struct {
+	ID             int        `db:"id" json:"id"`
+	VolunteerID    string     `db:"volunteer_id" json:"volunteerId"`
+	FullName       string     `db:"full_name" json:"fullName"`
+	AreaID         *int       `db:"area_id" json:"areaId"`
+	StartedAt      time.Time  `db:"started_at" json:"startedAt"`
+	EndedAt        *time.Time `db:"ended_at" json:"endedAt"`
+	DistanceMeters *float64   `db:"distance_meters" json:"distanceMeters"`
+	DoorsKnocked   *int       `db:"doors_knocked" json:"doorsKnocked"`
+}
+
+// ShiftTotals sums a volunteer's closed shifts, for recognition.
+type ShiftTotals struct {
+	VolunteerID    string  `db:"volunteer_id" json:"volunteerId"`
+	FullName       string  `db:"full_name" json:"fullName"`
+	Shifts         int     `db:"shifts" json:"shifts"`
+	Hours          float64 `db:"hours" json:"hours"`
+	DistanceMeters float64 `db:"distance_meters" json:"distanceMeters"`
+	DoorsKnocked   int     `db:"doors_knocked" json:"doorsKnocked"`
+}
+
+const shiftColumns = `id, volunteer_id, COALESCE(full_name, '') AS full_name, area_id,
+	started_at, ended_at, distance_meters, doors_knocked`
+
+// The open shift ID is cached in Redis so gating every position update costs
+// no database round trip. Postgres is authoritative: the cache is only
+// trusted for openShiftTTL, so a shift closed without clearing it (or a
+// failed delete) stops admitting positions soon after.
+const openShiftTTL = time.Minute
+
+func openShiftKey(volunteerID string) string {
+	return fmt.Sprintf("shift:%s", volunteerID)
+}
+
+// OpenShift starts a shift, or returns ErrShiftAlreadyOpen if one is open.
+func (r *ShiftRepository) OpenShift(ctx context.Context, volunteerID, fullName string, areaID *int) (Shift, error) {
+	var s Shift
+	err := r.DB.GetContext(ctx, &s, `
+		INSERT INTO shifts (volunteer_id, full_name, area_id)
+		VALUES ($1, NULLIF($2, ''), $3)
+		RETURNING `+shiftColumns, volunteerID, fullName, areaID)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case "23505": // unique_violation on shifts_open_key
+			return s, ErrShiftAlreadyOpen
+		case "23503": // foreign_key_violation
+			return s, ErrAreaNotFound
+		}
+	}
+	if err != nil {
+		return s, err
+	}
+	r.Redis.Set(ctx, openShiftKey(volunteerID), s.ID, openShiftTTL)
+	return s, nil
+}
+
+// GetOpenShift returns the volunteer's open shift or ErrNoOpenShift, dropping
+// any cached shift the database no longer has open.
+func (r *ShiftRepository) GetOpenShift(ctx context.Context, volunteerID string) (Shift, error) {
+	var s Shift
+	err := r.DB.GetContext(ctx, &s, `
+		SELECT `+shiftColumns+` FROM shifts
+		WHERE volunteer_id = $1 AND ended_at IS NULL`, volunteerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		r.Redis.Del(ctx, openShiftKey(volunteerID))
+		return s, ErrNoOpenShift
+	}
+	return s, err
+}
+
+// HasOpenShift checks the Redis cache first and falls back to Postgres,
+// re-caching what it finds, so a lost or expired cache never blocks a volunteer.
+func (r *ShiftRepository) HasOpenShift(ctx context.Context, volunteerID string) (bool, error) {
+	n, err := r.Redis.Exists(ctx, openShiftKey(volunteerID)).Result()
+	if err == nil && n > 0 {
+		return true, nil
+	}
+	s, err := r.GetOpenShift(ctx, volunteerID)
+	if errors.Is(err, ErrNoOpenShift) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	r.Redis.Set(ctx, openShiftKey(volunteerID), s.ID, openShiftTTL)
+	return true, nil
+}
+
+// CloseShift ends a shift with its final tallies.
+func (r *ShiftRepository) CloseShift(ctx context.Context, id int, endedAt time.Time, distance float64, doors int) (Shift, error) {
+	var s Shift
+	err := r.DB.GetContext(ctx, &s, `
+		UPDATE shifts
+		SET ended_at = $2, distance_meters = $3, doors_knocked = $4
+		WHERE id = $1 AND ended_at IS NULL
+		RETURNING `+shiftColumns, id, endedAt, distance, doors)
+	if errors.Is(err, sql.ErrNoRows) {
+		return s, ErrNoOpenShift
+	}
+	if err != nil {
+		return s, err
+	}
+	r.Redis.Del(ctx, openShiftKey(s.VolunteerID))
+	return s, nil
+}
+
+// ListOpen returns every open shift, i.e. who is checked in right now.
+func (r *ShiftRepository) ListOpen(ctx context.Context) ([]Shift, error) {
+	var shifts []Shift
+	err := r.DB.SelectContext(ctx, &shifts, `
+		SELECT `+shiftColumns+` FROM shifts WHERE ended_at IS NULL ORDER BY started_at`)
+	return shifts, err
+}
+
+// ListShifts returns shifts overlapping a time window, newest first; an empty
+// volunteerID matches every volunteer.
+func (r *ShiftRepository) ListShifts(ctx context.Context, volunteerID string, from, to time.Time) ([]Shift, error) {
+	var shifts []Shift
+	err := r.DB.SelectContext(ctx, &shifts, `
+		SELECT `+shiftColumns+` FROM shifts
+		WHERE started_at <= $3 AND (ended_at IS NULL OR ended_at >= $2)
+		  AND ($1 = '' OR volunteer_id::text = $1)
+		ORDER BY started_at DESC`, volunteerID, from, to)
+	return shifts, err
+}
+
+// Totals sums closed shifts that started in a time window, per volunteer.
+func (r *ShiftRepository) Totals(ctx context.Context, from, to time.Time) ([]ShiftTotals, error) {
+	var totals []ShiftTotals
+	err := r.DB.SelectContext(ctx, &totals, `
+		SELECT volunteer_id, COALESCE(MAX(full_name), '') AS full_name,
+		       COUNT(*) AS shifts,
+		       SUM(EXTRACT(EPOCH FROM ended_at - started_at)) / 3600 AS hours,
+		       COALESCE(SUM(distance_meters), 0) AS distance_meters,
+		       COALESCE(SUM(doors_knocked), 0) AS doors_knocked
+		FROM shifts
+		WHERE ended_at IS NOT NULL AND started_at BETWEEN $1 AND $2
+		GROUP BY volunteer_id
+		ORDER BY hours DESC`, from, to)
+	return totals, err
+}
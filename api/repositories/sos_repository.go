@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+)
+
+// SOSChannel carries emergency alerts, separate from the position feed.
+const SOSChannel = "sos"
+
+// SOS event types, published on SOSChannel and the admin live feed.
+const (
+	SOSRaised       = "sos.raised"
+	SOSReminder     = "sos.reminder" // still unacknowledged
+	SOSAcknowledged = "sos.acknowledged"
+	SOSResolved     = "sos.resolved"
+)
+
+// Incident states.
+const (
+	IncidentOpen         = "open"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+)
+
+var (
+	ErrIncidentNotFound = errors.New("incident not found")
+	ErrIncidentState    = errors.New("incident is not in a state that allows this")
+)
+
+type SOSRepository struct {
+	DB    *sqlx.DB
+	Redis *redis.Client
+}
+
+type Incident struct {
+	Type           string         `db:"-" json:"type,omitempty"`
+	ID             int            `db:"id" json:"id"`
+	VolunteerID    string         `db:"volunteer_id" json:"volunteerId"`
+	FullName       string         `db:"full_name" json:"fullName"`
+	Lat            *float64       `db:"lat" json:"lat"`
+	Lng            *float64       `db:"lng" json:"lng"`
+	Accuracy       *float64       `db:"accuracy" json:"accuracy,omitempty"`
+	Message        string         `db:"message" json:"message"`
+	Status         string         `db:"status" json:"status"`
+	RaisedAt       time.Time      `db:"raised_at" json:"raisedAt"`
+	AcknowledgedAt *time.Time     `db:"acknowledged_at" json:"acknowledgedAt"`
+	AcknowledgedBy *string        `db:"acknowledged_by" json:"acknowledgedBy"`
+	ResolvedAt     *time.Time     `db:"resolved_at" json:"resolvedAt"`
+	ResolvedBy     *string        `db:"resolved_by" json:"resolvedBy"`
+	Notes          []IncidentNote `db:"-" json:"notes,omitempty"`
+}
+
+type IncidentNote struct {
+	ID         int       `db:"id" json:"id"`
+	IncidentID int       `db:"incident_id" json:"incidentId"`
+	AuthorID   string    `db:"author_id" json:"authorId"`
+	AuthorName string    `db:"author_name" json:"authorName"`
+	Body       string    `db:"body" json:"body"`
+	CreatedAt  time.Time `db:"created_at" json:"createdAt"`
+}
+
+const incidentColumns = `id, volunteer_id, COALESCE(full_name, '') AS full_name,
+	ST_Y(position::geometry) AS lat, ST_X(position::geometry) AS lng, accuracy,
+	COALESCE(message, '') AS message, status, raised_at,
+	acknowledged_at, acknowledged_by, resolved_at, resolved_by`
+
+// Raise opens an incident, or re-raises the volunteer's unresolved one with
+// the new position and message so it is treated as urgent again.
+func (r *SOSRepository) Raise(ctx context.Context, in Incident) (Incident, error) {
+	var out Incident
+	query := `
+	INSERT INTO sos_incidents (volunteer_id, full_name, position, accuracy, message)
+	VALUES ($1, NULLIF($2, ''),
+	        CASE WHEN $3::float8 IS NULL OR $4::float8 IS NULL THEN NULL
+	             ELSE ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography END,
+	        $5, NULLIF($6, ''))
+	ON CONFLICT (volunteer_id) WHERE status <> 'resolved' DO UPDATE
+	SET position = COALESCE(EXCLUDED.position, sos_incidents.position),
+	    accuracy = COALESCE(EXCLUDED.accuracy, sos_incidents.accuracy),
+	    message = COALESCE(EXCLUDED.message, sos_incidents.message),
+	    status = 'open',
+	    acknowledged_at = NULL,
+	    acknowledged_by = NULL,
+	    last_broadcast_at = now()
+	RETURNING ` + incidentColumns
+	err := r.DB.GetContext(ctx, &out, query, in.VolunteerID, in.FullName, in.Lng, in.Lat, in.Accuracy, in.Message)
+	return out, err
+}
+
+func (r *SOSRepository) Get(ctx context.Context, id int) (Incident, error) {
+	var in Incident
+	err := r.DB.GetContext(ctx, &in, `SELECT `+incidentColumns+` FROM sos_incidents WHERE id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return in, ErrIncidentNotFound
+	}
+	if err != nil {
+		return in, err
+	}
+	err = r.DB.SelectContext(ctx, &in.Notes, `
+		SELECT id, incident_id, author_id, COALESCE(author_name, '') AS author_name, body, created_at
+		FROM sos_notes WHERE incident_id = $1 ORDER BY created_at, id`, id)
+	return in, err
+}
+
+// List returns incidents newest first; an empty status matches every
+// unresolved incident.
+func (r *SOSRepository) List(ctx context.Context, status string, limit int) ([]Incident, error) {
+	var out []Incident
+	err := r.DB.SelectContext(ctx, &out, `
+		SELECT `+incidentColumns+` FROM sos_incidents
+		WHERE ($1 = '' AND status <> 'resolved') OR status = $1
+		ORDER BY raised_at DESC
+		LIMIT $2`, status, limit)
+	return out, err
+}
+
+// Transition moves an incident to acknowledged (only from open) or resolved
+// (from either), stamping who did it. It returns ErrIncidentState if the
+// incident is in the wrong state.
+func (r *SOSRepository) Transition(ctx context.Context, id int, to, by string) (Incident, error) {
+	var out Incident
+	var query string
+	switch to {
+	case IncidentAcknowledged:
+		query = `
+		UPDATE sos_incidents SET status = 'acknowledged', acknowledged_at = now(), acknowledged_by = $2
+		WHERE id = $1 AND status = 'open'
+		RETURNING ` + incidentColumns
+	case IncidentResolved:
+		query = `
+		UPDATE sos_incidents SET status = 'resolved', resolved_at = now(), resolved_by = $2,
+		       acknowledged_at = COALESCE(acknowledged_at, now()), acknowledged_by = COALESCE(acknowledged_by, $2)
+		WHERE id = $1 AND status <> 'resolved'
+		RETURNING ` + incidentColumns
+	default:
+		return out, ErrIncidentState
+	}
+	err := r.DB.GetContext(ctx, &out, query, id, by)
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := r.Get(ctx, id); err != nil {
+			return out, err
+		}
+		return out, ErrIncidentState
+	}
+	return out, err
+}
+
+func (r *SOSRepository) AddNote(ctx context.Context, n IncidentNote) (IncidentNote, error) {
+	var out IncidentNote
+	err := r.DB.GetContext(ctx, &out, `
+		INSERT INTO sos_notes (incident_id, author_id, author_name, body)
+		SELECT id, $2, NULLIF($3, ''), $4 FROM sos_incidents WHERE id = $1
+		RETURNING id, incident_id, author_id, COALESCE(author_name, '') AS author_name, body, created_at`,
+		n.IncidentID, n.AuthorID, n.AuthorName, n.Body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return out, ErrIncidentNotFound
+	}
+	return out, err
+}
+
+// ClaimReminders returns open incidents not broadcast within every and marks
+// them broadcast now. The conditional update lets only one API instance
+// claim each reminder.
+func (r *SOSRepository) ClaimReminders(ctx context.Context, every time.Duration) ([]Incident, error) {
+	var out []Incident
+	err := r.DB.SelectContext(ctx, &out, `
+		UPDATE sos_incidents SET last_broadcast_at = now()
+		WHERE status = 'open' AND last_broadcast_at <= now() - make_interval(secs => $1)
+		RETURNING `+incidentColumns, every.Seconds())
+	return out, err
+}
+
+// Publish sends an incident event to the admin live feed and SOSChannel.
+func (r *SOSRepository) Publish(ctx context.Context, in Incident) error {
+	if _, err := appendStreamEvent(ctx, r.Redis, in.Type, in); err != nil {
+		return err
+	}
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return r.Redis.Publish(ctx, SOSChannel, string(data)).Err()
+}
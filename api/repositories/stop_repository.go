@@ -0,0 +1,140 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrStopNotFound = errors.New("stop not found")
+	ErrStopInUse    = errors.New("stop is still assigned")
+)
+
+type StopRepository struct {
+	DB *sqlx.DB
+}
+
+type Stop struct {
+	ID       int      `db:"id" json:"id"`
+	AreaID   int      `db:"area_id" json:"areaId"`
+	TurfID   *int     `db:"turf_id" json:"turfId,omitempty"`
+	Name     string   `db:"name" json:"name"`
+	Lat      float64  `db:"lat" json:"lat"`
+	Lng      float64  `db:"lng" json:"lng"`
+	Distance *float64 `db:"distance" json:"distanceMeters,omitempty"`
+}
+
+const stopColumns = `id, area_id, turf_id, COALESCE(name, '') AS name,
+	ST_Y(location::geometry) AS lat, ST_X(location::geometry) AS lng`
+
+const insertStopQuery = `
+	INSERT INTO stops (area_id, name, location)
+	VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography)
+	RETURNING ` + stopColumns
+
+func (r *StopRepository) CreateStop(ctx context.Context, s Stop) (Stop, error) {
+	var created Stop
+	err := r.DB.GetContext(ctx, &created, insertStopQuery, s.AreaID, s.Name, s.Lng, s.Lat)
+	return created, mapStopError(err)
+}
+
+// CreateStops inserts all stops in a single transaction; either every stop is
+// stored or none are.
+func (r *StopRepository) CreateStops(ctx context.Context, stops []Stop) ([]Stop, error) {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, insertStopQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	created := make([]Stop, 0, len(stops))
+	for _, s := range stops {
+		var c Stop
+		if err := stmt.GetContext(ctx, &c, s.AreaID, s.Name, s.Lng, s.Lat); err != nil {
+			return nil, mapStopError(err)
+		}
+		created = append(created, c)
+	}
+	return created, tx.Commit()
+}
+
+// ListStops returns an area's stops; for a turf, the stops cut into it.
+func (r *StopRepository) ListStops(ctx context.Context, areaID int) ([]Stop, error) {
+	var stops []Stop
+	err := r.DB.SelectContext(ctx, &stops,
+		`SELECT `+stopColumns+` FROM stops WHERE area_id = $1 OR turf_id = $1 ORDER BY id`, areaID)
+	return stops, err
+}
+
+// ListUnassigned returns stops nobody holds and nobody has knocked yet, in
+// one area (or turf) or everywhere when areaID is 0.
+func (r *StopRepository) ListUnassigned(ctx context.Context, areaID int) ([]Stop, error) {
+	var stops []Stop
+	err := r.DB.SelectContext(ctx, &stops, `
+		SELECT `+stopColumns+` FROM stops s
+		WHERE ($1 = 0 OR s.area_id = $1 OR s.turf_id = $1)
+		  AND NOT EXISTS (SELECT 1 FROM assignments a WHERE a.stop_id = s.id)
+		  AND NOT EXISTS (SELECT 1 FROM canvass_results r WHERE r.stop_id = s.id)
+		ORDER BY s.id`, areaID)
+	return stops, err
+}
+
+// StopsWithin returns an area's (or turf's) stops within radius meters of a point, nearest first.
+func (r *StopRepository) StopsWithin(ctx context.Context, areaID int, lat, lng, radius float64) ([]Stop, error) {
+	var stops []Stop
+	query := `
+	SELECT ` + stopColumns + `,
+	       ST_Distance(location, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography) AS distance
+	FROM stops
+	WHERE (area_id = $1 OR turf_id = $1)
+	  AND ST_DWithin(location, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, $4)
+	ORDER BY distance`
+	err := r.DB.SelectContext(ctx, &stops, query, areaID, lng, lat, radius)
+	return stops, err
+}
+
+// StopsInBBox returns an area's (or turf's) stops inside the given lng/lat envelope.
+func (r *StopRepository) StopsInBBox(ctx context.Context, areaID int, minLng, minLat, maxLng, maxLat float64) ([]Stop, error) {
+	var stops []Stop
+	query := `
+	SELECT ` + stopColumns + `
+	FROM stops
+	WHERE (area_id = $1 OR turf_id = $1)
+	  AND location::geometry && ST_MakeEnvelope($2, $3, $4, $5, 4326)
+	ORDER BY id`
+	err := r.DB.SelectContext(ctx, &stops, query, areaID, minLng, minLat, maxLng, maxLat)
+	return stops, err
+}
+
+func (r *StopRepository) DeleteStop(ctx context.Context, areaID, stopID int) error {
+	res, err := r.DB.ExecContext(ctx, `DELETE FROM stops WHERE id = $1 AND area_id = $2`, stopID, areaID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+			return ErrStopInUse
+		}
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrStopNotFound
+	}
+	return nil
+}
+
+// mapStopError turns a foreign key violation on area_id into ErrAreaNotFound.
+func mapStopError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		return ErrAreaNotFound
+	}
+	return err
+}
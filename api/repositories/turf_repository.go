@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// TurfRepository stores turfs: child areas cut from a parent area, each
+// holding a packet of the parent's stops.
+type TurfRepository struct {
+	DB *sqlx.DB
+}
+
+// Turf is one cut packet. ID is zero until the turf is saved.
+type Turf struct {
+	ID      int     `json:"id,omitempty"`
+	Name    string  `json:"name"`
+	StopIDs []int   `json:"stopIds"`
+	Polygon GeoJSON `json:"polygon"`
+}
+
+// turfHullQuery wraps a set of stops in a hull, pads it by $4 meters so
+// edge doors are inside, and clips it to the parent area. A clip that falls
+// apart keeps its largest piece; if nothing is left the padded hull is used.
+const turfHullQuery = `
+	WITH hull AS (
+		SELECT ST_Buffer(
+		           (CASE WHEN $3 THEN ST_ConcaveHull(ST_Collect(location::geometry), 0.8)
+		                 ELSE ST_ConvexHull(ST_Collect(location::geometry)) END)::geography,
+		           $4)::geometry AS h
+		FROM stops WHERE id = ANY($2)
+	), piece AS (
+		SELECT (ST_Dump(ST_Intersection(h, a.polygon::geometry))).geom AS p
+		FROM hull, areas a WHERE a.id = $1
+	)
+	SELECT ST_AsGeoJSON(COALESCE(
+		(SELECT p FROM piece WHERE ST_GeometryType(p) = 'ST_Polygon' ORDER BY ST_Area(p) DESC LIMIT 1),
+		(SELECT h FROM hull))) AS polygon`
+
+// Hull returns the polygon a turf over the given stops would get.
+func (r *TurfRepository) Hull(ctx context.Context, parentID int, stopIDs []int, concave bool, bufferMeters float64) (GeoJSON, error) {
+	var polygon GeoJSON
+	err := r.DB.GetContext(ctx, &polygon, turfHullQuery, parentID, pq.Array(stopIDs), concave, bufferMeters)
+	return polygon, err
+}
+
+// Replace deletes a parent area's existing turfs and saves the new ones,
+// pointing each stop at its turf, all in one transaction. Turfs that have
+// stops of their own cannot be replaced and yield ErrAreaInUse.
+func (r *TurfRepository) Replace(ctx context.Context, parentID int, turfs []Turf) ([]Turf, error) {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the parent so concurrent cuts of the same area serialize
+	var id int
+	if err := tx.GetContext(ctx, &id, `SELECT id FROM areas WHERE id = $1 FOR UPDATE`, parentID); err != nil {
+		return nil, mapTurfError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM areas WHERE parent_id = $1`, parentID); err != nil {
+		return nil, mapTurfError(err)
+	}
+
+	saved := make([]Turf, 0, len(turfs))
+	for _, t := range turfs {
+		err := tx.GetContext(ctx, &t.ID, `
+			INSERT INTO areas (name, parent_id, polygon)
+			VALUES ($1, $2, ST_SetSRID(ST_GeomFromGeoJSON($3), 4326)::geography)
+			RETURNING id`, t.Name, parentID, string(t.Polygon))
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE stops SET turf_id = $1 WHERE area_id = $2 AND id = ANY($3)`,
+			t.ID, parentID, pq.Array(t.StopIDs))
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, t)
+	}
+	return saved, tx.Commit()
+}
+
+// List returns the turfs cut from an area with their stops.
+func (r *TurfRepository) List(ctx context.Context, parentID int) ([]Turf, error) {
+	var rows []struct {
+		ID      int           `db:"id"`
+		Name    string        `db:"name"`
+		StopIDs pq.Int64Array `db:"stop_ids"`
+		Polygon GeoJSON       `db:"polygon"`
+	}
+	err := r.DB.SelectContext(ctx, &rows, `
+		SELECT a.id, COALESCE(a.name, '') AS name, ST_AsGeoJSON(a.polygon) AS polygon,
+		       COALESCE(array_agg(s.id ORDER BY s.id) FILTER (WHERE s.id IS NOT NULL), '{}') AS stop_ids
+		FROM areas a LEFT JOIN stops s ON s.turf_id = a.id
+		WHERE a.parent_id = $1
+		GROUP BY a.id
+		ORDER BY a.id`, parentID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Turf, 0, len(rows))
+	for _, row := range rows {
+		ids := make([]int, len(row.StopIDs))
+		for i, id := range row.StopIDs {
+			ids[i] = int(id)
+		}
+		out = append(out, Turf{ID: row.ID, Name: row.Name, StopIDs: ids, Polygon: row.Polygon})
+	}
+	return out, nil
+}
+
+func mapTurfError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAreaNotFound
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" { // stops still reference a turf
+		return ErrAreaInUse
+	}
+	return err
+}
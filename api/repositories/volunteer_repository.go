@@ -2,6 +2,8 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -14,26 +16,149 @@ type VolunteerRepository struct {
 }
 
 type Position struct {
-	ID        string    `db:"volunteer_id" json:"id"`
-	FullName  string    `db:"full_name" json:"fullName"`
-	Lat       float64   `db:"lat" json:"lat"`
-	Lng       float64   `db:"lng" json:"lng"`
-	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+	ID         string     `db:"volunteer_id" json:"id"`
+	FullName   string     `db:"full_name" json:"fullName"`
+	Lat        float64    `db:"lat" json:"lat"`
+	Lng        float64    `db:"lng" json:"lng"`
+	Accuracy   *float64   `db:"accuracy" json:"accuracy,omitempty"`     // horizontal, meters (95% radius)
+	Altitude   *float64   `db:"altitude" json:"altitude,omitempty"`     // meters above WGS84 ellipsoid
+	Heading    *float64   `db:"heading" json:"heading,omitempty"`       // degrees clockwise from true north
+	Speed      *float64   `db:"speed" json:"speed,omitempty"`           // meters per second
+	Battery    *float64   `db:"battery" json:"battery,omitempty"`       // charge level, 0 to 1
+	DeviceTime *time.Time `db:"device_time" json:"timestamp,omitempty"` // when the device took the fix
+	UpdatedAt  time.Time  `db:"updated_at" json:"updatedAt"`
+	Status     string     `db:"-" json:"status,omitempty"`   // presence, filled in for admin views
+	LastSeen   *time.Time `db:"-" json:"lastSeen,omitempty"` // when any fix last arrived
+	Sharing    []string   `db:"-" json:"sharing,omitempty"`  // any of "paused", "shift_only" and "coarse"; empty if sharing normally
 }
 
-// Upsert latest position into PostGIS
+// FlaggedPosition is an implausible fix held in history for review.
+type FlaggedPosition struct {
+	Position
+	Flag       string    `db:"flag" json:"flag"`
+	RecordedAt time.Time `db:"recorded_at" json:"recordedAt"`
+}
+
+// TrackPoint is one entry of a volunteer's position history.
+type TrackPoint struct {
+	Lat        float64   `db:"lat" json:"lat"`
+	Lng        float64   `db:"lng" json:"lng"`
+	RecordedAt time.Time `db:"recorded_at" json:"recordedAt"`
+}
+
+// Upsert latest position into PostGIS and append it to the history trail
 func (r *VolunteerRepository) UpsertPosition(ctx context.Context, pos Position) error {
+	return r.UpsertPositions(ctx, []Position{pos})
+}
+
+// UpsertPositions appends fixes to the history trail, stamped with their own
+// UpdatedAt, and moves the latest-position row forward if any is newer.
+func (r *VolunteerRepository) UpsertPositions(ctx context.Context, positions []Position) error {
+	tx, err := r.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-	INSERT INTO volunteer_positions (volunteer_id, full_name, position, updated_at)
-	VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography, NOW())
+	INSERT INTO volunteer_positions (volunteer_id, full_name, position, updated_at,
+	                                 accuracy, altitude, heading, speed, battery, device_time)
+	VALUES ($1, $2, ST_SetSRID(ST_MakePoint($3, $4), 4326)::geography, $5, $6, $7, $8, $9, $10, $11)
 	ON CONFLICT (volunteer_id) DO UPDATE
 	SET full_name = EXCLUDED.full_name,
 	    position = EXCLUDED.position,
-	    updated_at = NOW();`
-	_, err := r.DB.ExecContext(ctx, query, pos.ID, pos.FullName, pos.Lat, pos.Lng)
+	    updated_at = EXCLUDED.updated_at,
+	    accuracy = EXCLUDED.accuracy,
+	    altitude = EXCLUDED.altitude,
+	    heading = EXCLUDED.heading,
+	    speed = EXCLUDED.speed,
+	    battery = EXCLUDED.battery,
+	    device_time = EXCLUDED.device_time
+	WHERE volunteer_positions.updated_at IS NULL
+	   OR volunteer_positions.updated_at <= EXCLUDED.updated_at;`
+	history := `
+	INSERT INTO volunteer_position_history (volunteer_id, position, recorded_at,
+	                                        accuracy, altitude, heading, speed, battery, device_time)
+	VALUES ($1, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, $4, $5, $6, $7, $8, $9, $10);`
+
+	var newest *Position
+	for i := range positions {
+		pos := &positions[i]
+		_, err := tx.ExecContext(ctx, history, pos.ID, pos.Lng, pos.Lat, pos.UpdatedAt.UTC(),
+			pos.Accuracy, pos.Altitude, pos.Heading, pos.Speed, pos.Battery, pos.DeviceTime)
+		if err != nil {
+			return err
+		}
+		if newest == nil || pos.UpdatedAt.After(newest.UpdatedAt) {
+			newest = pos
+		}
+	}
+	if newest != nil {
+		_, err := tx.ExecContext(ctx, query, newest.ID, newest.FullName, newest.Lng, newest.Lat, newest.UpdatedAt.UTC(),
+			newest.Accuracy, newest.Altitude, newest.Heading, newest.Speed, newest.Battery, newest.DeviceTime)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// InsertFlaggedPosition stores a suspicious fix in history only; it never
+// becomes the volunteer's latest position or part of their track.
+func (r *VolunteerRepository) InsertFlaggedPosition(ctx context.Context, pos Position, flag string) error {
+	query := `
+	INSERT INTO volunteer_position_history (volunteer_id, position, recorded_at,
+	                                        accuracy, altitude, heading, speed, battery, device_time, flag)
+	VALUES ($1, ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography, $4, $5, $6, $7, $8, $9, $10, $11);`
+	_, err := r.DB.ExecContext(ctx, query, pos.ID, pos.Lng, pos.Lat, pos.UpdatedAt.UTC(),
+		pos.Accuracy, pos.Altitude, pos.Heading, pos.Speed, pos.Battery, pos.DeviceTime, flag)
 	return err
 }
 
+// ListFlaggedPositions returns flagged fixes in a time window, newest first;
+// an empty userID matches every volunteer.
+func (r *VolunteerRepository) ListFlaggedPositions(ctx context.Context, userID string, from, to time.Time) ([]FlaggedPosition, error) {
+	var out []FlaggedPosition
+	err := r.DB.SelectContext(ctx, &out, `
+		SELECT volunteer_id, ST_Y(position::geometry) AS lat, ST_X(position::geometry) AS lng,
+		       accuracy, altitude, heading, speed, battery, device_time,
+		       recorded_at AS updated_at, recorded_at, flag
+		FROM volunteer_position_history
+		WHERE flag IS NOT NULL AND recorded_at BETWEEN $2 AND $3
+		  AND ($1 = '' OR volunteer_id::text = $1)
+		ORDER BY recorded_at DESC
+		LIMIT 1000`, userID, from, to)
+	return out, err
+}
+
+// Suspect fixes are remembered briefly so a genuine jump (e.g. the volunteer
+// drove to a new turf) is accepted once a second fix confirms it.
+func suspectKey(userID string) string {
+	return fmt.Sprintf("suspect:%s", userID)
+}
+
+func (r *VolunteerRepository) GetSuspectPosition(ctx context.Context, userID string) (Position, error) {
+	var p Position
+	data, err := r.Redis.Get(ctx, suspectKey(userID)).Result()
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal([]byte(data), &p)
+	return p, err
+}
+
+func (r *VolunteerRepository) SetSuspectPosition(ctx context.Context, pos Position, ttl time.Duration) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+	return r.Redis.Set(ctx, suspectKey(pos.ID), string(data), ttl).Err()
+}
+
+func (r *VolunteerRepository) ClearSuspectPosition(ctx context.Context, userID string) error {
+	return r.Redis.Del(ctx, suspectKey(userID)).Err()
+}
+
 // Get last persisted position for comparison
 func (r *VolunteerRepository) GetLastPosition(ctx context.Context, userID string) (Position, error) {
 	var p Position
@@ -43,12 +168,61 @@ func (r *VolunteerRepository) GetLastPosition(ctx context.Context, userID string
 	return p, err
 }
 
+// Get the live position cached in Redis; returns redis.Nil if it has expired
+func (r *VolunteerRepository) GetLivePosition(ctx context.Context, userID string) (Position, error) {
+	var p Position
+	data, err := r.Redis.Get(ctx, fmt.Sprintf("position:%s", userID)).Result()
+	if err != nil {
+		return p, err
+	}
+	err = json.Unmarshal([]byte(data), &p)
+	return p, err
+}
+
+// DeleteLivePosition takes a volunteer off the live map at once rather than
+// waiting for the key to expire
+func (r *VolunteerRepository) DeleteLivePosition(ctx context.Context, userID string) error {
+	return r.Redis.Del(ctx, fmt.Sprintf("position:%s", userID)).Err()
+}
+
+// DeleteLatestPosition drops the volunteer's stored latest position; their
+// history is kept.
+func (r *VolunteerRepository) DeleteLatestPosition(ctx context.Context, userID string) error {
+	_, err := r.DB.ExecContext(ctx, `DELETE FROM volunteer_positions WHERE volunteer_id = $1`, userID)
+	return err
+}
+
+// ReplaceLatestPoint overwrites the stored latest position in place, keeping
+// its timestamps, and drops the readings that could refine it.
+func (r *VolunteerRepository) ReplaceLatestPoint(ctx context.Context, pos Position) error {
+	_, err := r.DB.ExecContext(ctx, `
+		UPDATE volunteer_positions
+		SET position = ST_SetSRID(ST_MakePoint($2, $3), 4326)::geography,
+		    accuracy = $4, altitude = NULL, heading = NULL, speed = NULL
+		WHERE volunteer_id = $1`, pos.ID, pos.Lng, pos.Lat, pos.Accuracy)
+	return err
+}
+
 func (r *VolunteerRepository) GetAllPositions(ctx context.Context) ([]Position, error) {
 	var positions []Position
 	err := r.DB.SelectContext(ctx, &positions, `
 		SELECT volunteer_id,
 		       ST_Y(position::geometry) AS lat,
-		       ST_X(position::geometry) AS lng
+		       ST_X(position::geometry) AS lng,
+		       accuracy, altitude, heading, speed, battery, device_time, updated_at
 		FROM volunteer_positions`)
 	return positions, err
 }
+
+// Get a volunteer's position history between two instants, oldest first
+func (r *VolunteerRepository) GetTrack(ctx context.Context, userID string, from, to time.Time) ([]TrackPoint, error) {
+	var points []TrackPoint
+	err := r.DB.SelectContext(ctx, &points, `
+		SELECT ST_Y(position::geometry) AS lat,
+		       ST_X(position::geometry) AS lng,
+		       recorded_at
+		FROM volunteer_position_history
+		WHERE volunteer_id = $1 AND recorded_at BETWEEN $2 AND $3 AND flag IS NULL
+		ORDER BY recorded_at, id`, userID, from, to)
+	return points, err
+}
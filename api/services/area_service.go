@@ -0,0 +1,133 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type AreaService struct {
+	Repo *repositories.AreaRepository
+}
+
+// ValidationError is returned when client-supplied input is rejected; its
+// message is safe to show to the caller.
+type ValidationError struct {
+	Msg string
+}
+
+func (e *ValidationError) Error() string { return e.Msg }
+
+func invalidf(format string, args ...interface{}) error {
+	return &ValidationError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// polygonGeometry is the subset of a GeoJSON Polygon we care about.
+type polygonGeometry struct {
+	Type        string          `json:"type"`
+	Coordinates [][][]float64   `json:"coordinates"`
+	Geometry    json.RawMessage `json:"geometry,omitempty"` // set when a Feature is supplied
+}
+
+// normalizePolygon accepts a GeoJSON Polygon geometry (or a Feature wrapping
+// one), checks its structure and returns the bare geometry.
+func normalizePolygon(raw repositories.GeoJSON) (repositories.GeoJSON, [][][]float64, error) {
+	if len(raw) == 0 {
+		return nil, nil, invalidf("polygon is required")
+	}
+
+	var g polygonGeometry
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, nil, invalidf("polygon is not valid GeoJSON: %v", err)
+	}
+	if g.Type == "Feature" {
+		if len(g.Geometry) == 0 || string(g.Geometry) == "null" {
+			return nil, nil, invalidf("feature has no geometry")
+		}
+		return normalizePolygon(repositories.GeoJSON(g.Geometry))
+	}
+	if g.Type != "Polygon" {
+		return nil, nil, invalidf("expected GeoJSON type Polygon, got %q", g.Type)
+	}
+	if len(g.Coordinates) == 0 {
+		return nil, nil, invalidf("polygon has no rings")
+	}
+
+	for i, ring := range g.Coordinates {
+		if len(ring) < 4 {
+			return nil, nil, invalidf("ring %d must have at least 4 positions, got %d", i, len(ring))
+		}
+		for j, p := range ring {
+			if len(p) < 2 {
+				return nil, nil, invalidf("ring %d position %d must be [lng, lat]", i, j)
+			}
+			if p[0] < -180 || p[0] > 180 || p[1] < -90 || p[1] > 90 {
+				return nil, nil, invalidf("ring %d position %d is out of range: [%g, %g]", i, j, p[0], p[1])
+			}
+		}
+		first, last := ring[0], ring[len(ring)-1]
+		if first[0] != last[0] || first[1] != last[1] {
+			return nil, nil, invalidf("ring %d is not closed: first and last positions must match", i)
+		}
+	}
+
+	clean, _ := json.Marshal(struct {
+		Type        string        `json:"type"`
+		Coordinates [][][]float64 `json:"coordinates"`
+	}{"Polygon", g.Coordinates})
+	return clean, g.Coordinates, nil
+}
+
+// validatePolygon runs the structural checks and then PostGIS's ST_IsValid.
+func (s *AreaService) validatePolygon(ctx context.Context, raw repositories.GeoJSON) (repositories.GeoJSON, error) {
+	polygon, _, err := normalizePolygon(raw)
+	if err != nil {
+		return nil, err
+	}
+	valid, reason, err := s.Repo.ValidatePolygon(ctx, polygon)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, invalidf("polygon geometry is invalid: %s", reason)
+	}
+	return polygon, nil
+}
+
+func (s *AreaService) CreateArea(ctx context.Context, name string, polygon repositories.GeoJSON) (repositories.Area, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return repositories.Area{}, invalidf("name is required")
+	}
+	clean, err := s.validatePolygon(ctx, polygon)
+	if err != nil {
+		return repositories.Area{}, err
+	}
+	return s.Repo.CreateArea(ctx, name, clean)
+}
+
+func (s *AreaService) ListAreas(ctx context.Context) ([]repositories.Area, error) {
+	return s.Repo.ListAreas(ctx)
+}
+
+func (s *AreaService) GetArea(ctx context.Context, id int) (repositories.Area, error) {
+	return s.Repo.GetArea(ctx, id)
+}
+
+func (s *AreaService) UpdateArea(ctx context.Context, id int, name string, polygon repositories.GeoJSON) (repositories.Area, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return repositories.Area{}, invalidf("name is required")
+	}
+	clean, err := s.validatePolygon(ctx, polygon)
+	if err != nil {
+		return repositories.Area{}, err
+	}
+	return s.Repo.UpdateArea(ctx, id, name, clean)
+}
+
+func (s *AreaService) DeleteArea(ctx context.Context, id int) error {
+	return s.Repo.DeleteArea(ctx, id)
+}
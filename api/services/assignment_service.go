@@ -0,0 +1,180 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"log"
+	"strings"
+	"time"
+)
+
+type AssignmentService struct {
+	Repo       *repositories.AssignmentRepository
+	Stops      *repositories.StopRepository
+	Volunteers *repositories.VolunteerRepository
+	Hub        *ChannelHub // fans assignment events out to volunteers' live connections
+	Routes     *RouteService
+}
+
+// AssignmentTarget selects stops either explicitly or as every stop in an area.
+type AssignmentTarget struct {
+	StopIDs []int `json:"stopIds"`
+	AreaID  int   `json:"areaId"`
+}
+
+// isUUID reports whether s looks like a canonical UUID (Keycloak user IDs).
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, r := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if r != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func normalizeVolunteerID(id string) (string, error) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if !isUUID(id) {
+		return "", invalidf("invalid volunteer id %q", id)
+	}
+	return id, nil
+}
+
+// resolveStops expands a target into stop IDs. A nil result means the caller
+// gave neither stopIds nor areaId, i.e. "all of the volunteer's stops".
+func (s *AssignmentService) resolveStops(ctx context.Context, t AssignmentTarget) ([]int, error) {
+	if len(t.StopIDs) > 0 && t.AreaID != 0 {
+		return nil, invalidf("specify stopIds or areaId, not both")
+	}
+	if t.AreaID != 0 {
+		stops, err := s.Stops.ListStops(ctx, t.AreaID)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]int, 0, len(stops))
+		for _, st := range stops {
+			ids = append(ids, st.ID)
+		}
+		return ids, nil
+	}
+	return t.StopIDs, nil
+}
+
+func (s *AssignmentService) Assign(ctx context.Context, volunteerID string, t AssignmentTarget) ([]int, error) {
+	volunteerID, err := normalizeVolunteerID(volunteerID)
+	if err != nil {
+		return nil, err
+	}
+	stopIDs, err := s.resolveStops(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	if len(stopIDs) == 0 {
+		return nil, invalidf("no stops to assign")
+	}
+
+	assigned, err := s.Repo.Assign(ctx, volunteerID, stopIDs)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ctx, volunteerID, "assigned", assigned)
+	return assigned, nil
+}
+
+func (s *AssignmentService) Unassign(ctx context.Context, volunteerID string, t AssignmentTarget) ([]int, error) {
+	volunteerID, err := normalizeVolunteerID(volunteerID)
+	if err != nil {
+		return nil, err
+	}
+	stopIDs, err := s.resolveStops(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	removed, err := s.Repo.Unassign(ctx, volunteerID, stopIDs)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ctx, volunteerID, "unassigned", removed)
+	return removed, nil
+}
+
+func (s *AssignmentService) Reassign(ctx context.Context, fromID, toID string, t AssignmentTarget) ([]int, error) {
+	fromID, err := normalizeVolunteerID(fromID)
+	if err != nil {
+		return nil, err
+	}
+	toID, err = normalizeVolunteerID(toID)
+	if err != nil {
+		return nil, err
+	}
+	if fromID == toID {
+		return nil, invalidf("cannot reassign stops to the same volunteer")
+	}
+	stopIDs, err := s.resolveStops(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+
+	moved, err := s.Repo.Reassign(ctx, fromID, toID, stopIDs)
+	if err != nil {
+		return nil, err
+	}
+	s.notify(ctx, fromID, "unassigned", moved)
+	s.notify(ctx, toID, "assigned", moved)
+	return moved, nil
+}
+
+func (s *AssignmentService) ListAssignments(ctx context.Context, volunteerID string, areaID int) ([]repositories.Assignment, error) {
+	if volunteerID != "" {
+		var err error
+		if volunteerID, err = normalizeVolunteerID(volunteerID); err != nil {
+			return nil, err
+		}
+	}
+	return s.Repo.ListAssignments(ctx, volunteerID, areaID)
+}
+
+// MyAssignments returns the volunteer's stops nearest-first from their live
+// position, falling back to the last persisted one, or stop order if neither exists.
+func (s *AssignmentService) MyAssignments(ctx context.Context, volunteerID string) ([]repositories.Assignment, error) {
+	if pos, ok := s.lastKnownPosition(ctx, volunteerID); ok {
+		return s.Repo.ListForVolunteerFrom(ctx, volunteerID, pos.Lat, pos.Lng)
+	}
+	return s.Repo.ListAssignments(ctx, volunteerID, 0)
+}
+
+func (s *AssignmentService) lastKnownPosition(ctx context.Context, volunteerID string) (repositories.Position, bool) {
+	if pos, err := s.Volunteers.GetLivePosition(ctx, volunteerID); err == nil {
+		return pos, true
+	}
+	if pos, err := s.Volunteers.GetLastPosition(ctx, volunteerID); err == nil {
+		return pos, true
+	}
+	return repositories.Position{}, false
+}
+
+// notify pushes an assignment change to the volunteer. Delivery is best
+// effort: the database is the source of truth and clients re-fetch on events.
+func (s *AssignmentService) notify(ctx context.Context, volunteerID, kind string, stopIDs []int) {
+	if len(stopIDs) == 0 {
+		return
+	}
+	ev := repositories.AssignmentEvent{Type: kind, StopIDs: stopIDs, At: time.Now().UTC()}
+	if err := s.Repo.PublishEvent(ctx, volunteerID, ev); err != nil {
+		log.Println("assignment publish error:", err)
+	}
+	if s.Routes != nil {
+		s.Routes.Replan(volunteerID)
+	}
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"strings"
+)
+
+// MaxNotesLength caps free-text door notes.
+const MaxNotesLength = 2000
+
+type CanvassService struct {
+	Repo   *repositories.CanvassRepository
+	Areas  *repositories.AreaRepository
+	Routes *RouteService
+}
+
+func validOutcome(o string) bool {
+	for _, v := range repositories.Outcomes {
+		if o == v {
+			return true
+		}
+	}
+	return false
+}
+
+// RecordResult stores a door-knock outcome for a stop assigned to the
+// volunteer, and re-plans their route now that the stop is done.
+func (s *CanvassService) RecordResult(ctx context.Context, res repositories.CanvassResult) (repositories.CanvassResult, error) {
+	res.Outcome = strings.ToLower(strings.TrimSpace(res.Outcome))
+	if !validOutcome(res.Outcome) {
+		return res, invalidf("outcome must be one of %s", strings.Join(repositories.Outcomes, ", "))
+	}
+	res.Notes = strings.TrimSpace(res.Notes)
+	if len(res.Notes) > MaxNotesLength {
+		return res, invalidf("notes must be at most %d characters", MaxNotesLength)
+	}
+	saved, err := s.Repo.RecordResult(ctx, res)
+	if err != nil {
+		return saved, err
+	}
+	if s.Routes != nil {
+		s.Routes.Replan(saved.VolunteerID)
+	}
+	return saved, nil
+}
+
+func (s *CanvassService) AreaSummary(ctx context.Context, areaID int) (repositories.OutcomeSummary, error) {
+	if _, err := s.Areas.GetArea(ctx, areaID); err != nil {
+		return repositories.OutcomeSummary{}, err
+	}
+	return s.Repo.AreaSummary(ctx, areaID)
+}
+
+func (s *CanvassService) VolunteerSummary(ctx context.Context, volunteerID string) (repositories.OutcomeSummary, error) {
+	volunteerID, err := normalizeVolunteerID(volunteerID)
+	if err != nil {
+		return repositories.OutcomeSummary{}, err
+	}
+	return s.Repo.VolunteerSummary(ctx, volunteerID)
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ChannelHub holds a single Redis pattern subscription per API instance and
+// fans each message out to the clients registered for its exact channel, so
+// per-user streams don't cost one Redis subscription per connection.
+type ChannelHub struct {
+	Redis   *redis.Client
+	Pattern string // e.g. "assignments:*"
+	Metrics StreamMetrics
+
+	mu      sync.RWMutex
+	clients map[string]map[*ChannelClient]struct{}
+}
+
+// ChannelClient is one registration with a ChannelHub.
+type ChannelClient struct {
+	channel string
+	deliver func(payload []byte) bool
+}
+
+// Register starts delivering messages on channel. deliver must not block;
+// returning false unregisters the client.
+func (h *ChannelHub) Register(channel string, deliver func(payload []byte) bool) *ChannelClient {
+	c := &ChannelClient{channel: channel, deliver: deliver}
+
+	h.mu.Lock()
+	if h.clients == nil {
+		h.clients = make(map[string]map[*ChannelClient]struct{})
+	}
+	if h.clients[channel] == nil {
+		h.clients[channel] = make(map[*ChannelClient]struct{})
+	}
+	h.clients[channel][c] = struct{}{}
+	h.mu.Unlock()
+
+	h.Metrics.clientJoined()
+	return c
+}
+
+func (h *ChannelHub) Unregister(c *ChannelClient) {
+	h.mu.Lock()
+	set := h.clients[c.channel]
+	_, ok := set[c]
+	delete(set, c)
+	if len(set) == 0 {
+		delete(h.clients, c.channel)
+	}
+	h.mu.Unlock()
+
+	if ok {
+		h.Metrics.clientLeft()
+	}
+}
+
+// Run subscribes to Pattern and dispatches messages until ctx is cancelled,
+// resubscribing if the subscription drops.
+func (h *ChannelHub) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		sub := h.Redis.PSubscribe(ctx, h.Pattern)
+		for msg := range sub.Channel() {
+			h.dispatch(msg.Channel, []byte(msg.Payload))
+		}
+		sub.Close()
+		if ctx.Err() == nil {
+			log.Println("channel hub: subscription to", h.Pattern, "closed, resubscribing")
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func (h *ChannelHub) dispatch(channel string, payload []byte) {
+	h.mu.RLock()
+	targets := make([]*ChannelClient, 0, len(h.clients[channel]))
+	for c := range h.clients[channel] {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		if !c.deliver(payload) {
+			h.Unregister(c)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Dispatch defaults, overridable via DISPATCH_CAPACITY and DISPATCH_INTERVAL.
+const (
+	DefaultDispatchCapacity = 25
+	MaxDispatchCapacity     = 1000
+)
+
+// Dispatch units.
+const (
+	DispatchStops = "stops"
+	DispatchTurfs = "turfs"
+)
+
+// DispatchService hands unassigned stops, or whole turfs, to checked-in
+// volunteers, nearest first, without giving anyone more outstanding stops
+// than their capacity. Proposals are previewed and then committed through
+// AssignmentService, so volunteers are notified and their routes re-planned.
+type DispatchService struct {
+	Assignments *AssignmentService
+	AssignRepo  *repositories.AssignmentRepository
+	Stops       *repositories.StopRepository
+	Turfs       *repositories.TurfRepository
+	Shifts      *repositories.ShiftRepository
+	Volunteers  *repositories.VolunteerRepository
+	Capacity    int           // outstanding stops per volunteer
+	Interval    time.Duration // continuous dispatch; 0 disables it
+}
+
+// DispatchRequest scopes a dispatch round. AreaID limits it to one area or
+// turf, and is required for Mode "turfs". Capacity overrides the default for
+// everyone and Capacities for individual volunteers. VolunteerIDs limits the
+// round to some of the checked-in volunteers.
+type DispatchRequest struct {
+	AreaID       int            `json:"areaId"`
+	Mode         string         `json:"mode"`
+	Capacity     int            `json:"capacity"`
+	Capacities   map[string]int `json:"capacities"`
+	VolunteerIDs []string       `json:"volunteerIds"`
+}
+
+type DispatchAssignment struct {
+	VolunteerID    string     `json:"volunteerId"`
+	FullName       string     `json:"fullName"`
+	Start          RoutePoint `json:"start"`
+	StopIDs        []int      `json:"stopIds"`
+	TurfIDs        []int      `json:"turfIds,omitempty"`
+	DistanceMeters float64    `json:"distanceMeters"` // sum of straight lines from start to each stop or turf
+}
+
+type DispatchSkip struct {
+	VolunteerID string `json:"volunteerId"`
+	FullName    string `json:"fullName"`
+	Reason      string `json:"reason"`
+}
+
+type DispatchProposal struct {
+	Mode              string               `json:"mode"`
+	Assignments       []DispatchAssignment `json:"assignments"`
+	UnassignedStopIDs []int                `json:"unassignedStopIds"`
+	Skipped           []DispatchSkip       `json:"skipped"`
+}
+
+// DispatchResult reports a commit per volunteer; one volunteer's conflict
+// does not stop the others from getting their stops.
+type DispatchResult struct {
+	VolunteerID string `json:"volunteerId"`
+	Assigned    []int  `json:"assigned"`
+	Error       string `json:"error,omitempty"`
+}
+
+// dispatchUnit is a stop or a turf's remaining stops, handed out whole.
+type dispatchUnit struct {
+	turfID  int
+	stopIDs []int
+	at      RoutePoint
+	areaIDs map[int]bool // areas and turfs the unit lies in, for shift areas
+}
+
+type dispatchVolunteer struct {
+	shift     repositories.Shift
+	start     RoutePoint
+	remaining int
+}
+
+// Preview proposes assignments without changing anything.
+func (s *DispatchService) Preview(ctx context.Context, req DispatchRequest) (DispatchProposal, error) {
+	p := DispatchProposal{Assignments: []DispatchAssignment{}, UnassignedStopIDs: []int{}, Skipped: []DispatchSkip{}}
+	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
+	if req.Mode == "" {
+		req.Mode = DispatchStops
+	}
+	if req.Mode != DispatchStops && req.Mode != DispatchTurfs {
+		return p, invalidf("mode must be %q or %q", DispatchStops, DispatchTurfs)
+	}
+	if req.Mode == DispatchTurfs && req.AreaID == 0 {
+		return p, invalidf("areaId is required to dispatch turfs")
+	}
+	p.Mode = req.Mode
+	if req.Capacity == 0 {
+		req.Capacity = s.Capacity
+	}
+	if req.Capacity < 1 || req.Capacity > MaxDispatchCapacity {
+		return p, invalidf("capacity must be between 1 and %d", MaxDispatchCapacity)
+	}
+	capacities := make(map[string]int, len(req.Capacities))
+	for id, c := range req.Capacities {
+		nid, err := normalizeVolunteerID(id)
+		if err != nil {
+			return p, err
+		}
+		if c < 0 || c > MaxDispatchCapacity {
+			return p, invalidf("capacity for %s must be between 0 and %d", nid, MaxDispatchCapacity)
+		}
+		capacities[nid] = c
+	}
+	var only map[string]bool
+	if len(req.VolunteerIDs) > 0 {
+		only = make(map[string]bool, len(req.VolunteerIDs))
+		for _, id := range req.VolunteerIDs {
+			nid, err := normalizeVolunteerID(id)
+			if err != nil {
+				return p, err
+			}
+			only[nid] = true
+		}
+	}
+
+	units, err := s.units(ctx, req)
+	if err != nil {
+		return p, err
+	}
+	vols, skipped, err := s.available(ctx, req.Capacity, capacities, only)
+	if err != nil {
+		return p, err
+	}
+	p.Skipped = append(p.Skipped, skipped...)
+
+	// Greedy on the globally shortest volunteer-to-unit distance: each round
+	// fixes the cheapest pair that still fits, which keeps everyone near
+	// their work and fills volunteers from their own doorstep outwards.
+	type pair struct {
+		v, u int
+		d    float64
+	}
+	var pairs []pair
+	for vi, v := range vols {
+		for ui, u := range units {
+			if v.shift.AreaID != nil && !u.areaIDs[*v.shift.AreaID] {
+				continue // checked in for a different area
+			}
+			pairs = append(pairs, pair{vi, ui, haversine(v.start.Lat, v.start.Lng, u.at.Lat, u.at.Lng)})
+		}
+	}
+	sort.Slice(pairs, func(a, b int) bool { return pairs[a].d < pairs[b].d })
+
+	taken := make([]bool, len(units))
+	byVol := make(map[int]*DispatchAssignment, len(vols))
+	for _, pr := range pairs {
+		v, u := &vols[pr.v], units[pr.u]
+		if taken[pr.u] || v.remaining < len(u.stopIDs) {
+			continue
+		}
+		taken[pr.u] = true
+		v.remaining -= len(u.stopIDs)
+		a := byVol[pr.v]
+		if a == nil {
+			a = &DispatchAssignment{VolunteerID: v.shift.VolunteerID, FullName: v.shift.FullName, Start: v.start, StopIDs: []int{}}
+			byVol[pr.v] = a
+		}
+		a.StopIDs = append(a.StopIDs, u.stopIDs...)
+		if u.turfID != 0 {
+			a.TurfIDs = append(a.TurfIDs, u.turfID)
+		}
+		a.DistanceMeters += pr.d
+	}
+
+	for vi := range vols {
+		if a := byVol[vi]; a != nil {
+			sort.Ints(a.StopIDs)
+			p.Assignments = append(p.Assignments, *a)
+		}
+	}
+	for ui, u := range units {
+		if !taken[ui] {
+			p.UnassignedStopIDs = append(p.UnassignedStopIDs, u.stopIDs...)
+		}
+	}
+	sort.Ints(p.UnassignedStopIDs)
+	return p, nil
+}
+
+// units loads what is to be handed out: single unassigned stops, or for
+// turfs each turf's unassigned stops as one unit placed at their centroid.
+func (s *DispatchService) units(ctx context.Context, req DispatchRequest) ([]dispatchUnit, error) {
+	stops, err := s.Stops.ListUnassigned(ctx, req.AreaID)
+	if err != nil {
+		return nil, err
+	}
+	if req.Mode == DispatchStops {
+		units := make([]dispatchUnit, 0, len(stops))
+		for _, st := range stops {
+			u := dispatchUnit{stopIDs: []int{st.ID}, at: RoutePoint{Lat: st.Lat, Lng: st.Lng}, areaIDs: map[int]bool{st.AreaID: true}}
+			if st.TurfID != nil {
+				u.areaIDs[*st.TurfID] = true
+			}
+			units = append(units, u)
+		}
+		return units, nil
+	}
+
+	free := make(map[int]repositories.Stop, len(stops))
+	for _, st := range stops {
+		free[st.ID] = st
+	}
+	turfs, err := s.Turfs.List(ctx, req.AreaID)
+	if err != nil {
+		return nil, err
+	}
+	var units []dispatchUnit
+	for _, t := range turfs {
+		u := dispatchUnit{turfID: t.ID, areaIDs: map[int]bool{t.ID: true, req.AreaID: true}}
+		var pts []RoutePoint
+		for _, id := range t.StopIDs {
+			if st, ok := free[id]; ok {
+				u.stopIDs = append(u.stopIDs, id)
+				pts = append(pts, RoutePoint{Lat: st.Lat, Lng: st.Lng})
+			}
+		}
+		if len(u.stopIDs) == 0 {
+			continue
+		}
+		u.at = centroid(pts, nil)
+		units = append(units, u)
+	}
+	return units, nil
+}
+
+// available returns the checked-in volunteers who have a known position and
+// room for more stops, and why the others were left out.
+func (s *DispatchService) available(ctx context.Context, capacity int, capacities map[string]int, only map[string]bool) ([]dispatchVolunteer, []DispatchSkip, error) {
+	shifts, err := s.Shifts.ListOpen(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	var vols []dispatchVolunteer
+	var skipped []DispatchSkip
+	for _, sh := range shifts {
+		if only != nil && !only[sh.VolunteerID] {
+			continue
+		}
+		skip := func(reason string) {
+			skipped = append(skipped, DispatchSkip{VolunteerID: sh.VolunteerID, FullName: sh.FullName, Reason: reason})
+		}
+
+		pos, err := s.Volunteers.GetLivePosition(ctx, sh.VolunteerID)
+		if err != nil {
+			if !errors.Is(err, redis.Nil) {
+				log.Println("dispatch live position error:", err)
+			}
+			if pos, err = s.Volunteers.GetLastPosition(ctx, sh.VolunteerID); err != nil {
+				skip("no known position")
+				continue
+			}
+		}
+
+		pending, err := s.AssignRepo.ListPending(ctx, sh.VolunteerID)
+		if err != nil {
+			return nil, nil, err
+		}
+		c := capacity
+		if v, ok := capacities[sh.VolunteerID]; ok {
+			c = v
+		}
+		if len(pending) >= c {
+			skip("at capacity")
+			continue
+		}
+		vols = append(vols, dispatchVolunteer{
+			shift:     sh,
+			start:     RoutePoint{Lat: pos.Lat, Lng: pos.Lng},
+			remaining: c - len(pending),
+		})
+	}
+	return vols, skipped, nil
+}
+
+// Commit assigns a previewed proposal, volunteer by volunteer. Stops taken
+// in the meantime make that volunteer's assignment fail as a whole.
+func (s *DispatchService) Commit(ctx context.Context, assignments []DispatchAssignment) ([]DispatchResult, error) {
+	if len(assignments) == 0 {
+		return nil, invalidf("no assignments to commit")
+	}
+	results := make([]DispatchResult, 0, len(assignments))
+	for _, a := range assignments {
+		res := DispatchResult{VolunteerID: a.VolunteerID, Assigned: []int{}}
+		assigned, err := s.Assignments.Assign(ctx, a.VolunteerID, AssignmentTarget{StopIDs: a.StopIDs})
+		var verr *ValidationError
+		switch {
+		case err == nil:
+			if assigned != nil {
+				res.Assigned = assigned
+			}
+		case errors.As(err, &verr), errors.Is(err, repositories.ErrStopAlreadyAssigned), errors.Is(err, repositories.ErrStopNotFound):
+			res.Error = err.Error()
+		default:
+			return results, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// Run dispatches every Interval until ctx is cancelled, committing without
+// preview. Only one instance dispatches per round.
+func (s *DispatchService) Run(ctx context.Context) {
+	if s.Interval <= 0 {
+		log.Println("continuous dispatch disabled")
+		return
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		ok, err := s.AssignRepo.LockDispatch(ctx, s.Interval)
+		if err != nil {
+			log.Println("dispatch lock error:", err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		p, err := s.Preview(ctx, DispatchRequest{})
+		if err != nil {
+			log.Println("dispatch error:", err)
+			continue
+		}
+		if len(p.Assignments) == 0 {
+			continue
+		}
+		results, err := s.Commit(ctx, p.Assignments)
+		if err != nil {
+			log.Println("dispatch commit error:", err)
+		}
+		n := 0
+		for _, r := range results {
+			n += len(r.Assigned)
+		}
+		log.Printf("dispatch: assigned %d stops to %d volunteers", n, len(results))
+	}
+}
@@ -0,0 +1,362 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Export datasets.
+const (
+	ExportPositions = "positions"
+	ExportTracks    = "tracks"
+	ExportResults   = "results"
+)
+
+// Export formats; GeoJSON, KML and CSV are shared with imports.
+const FormatGPX = "gpx"
+
+// ExportService streams positions, tracks and canvass results in formats
+// GIS tools load directly. Rows go from Postgres to the writer one at a
+// time.
+type ExportService struct {
+	Repo *repositories.ExportRepository
+}
+
+// Export describes a validated export, so callers can set response headers
+// before anything is streamed.
+type Export struct {
+	Dataset     string
+	Format      string
+	ContentType string
+	Filename    string
+}
+
+var exportContentTypes = map[string]string{
+	FormatGeoJSON: "application/geo+json",
+	FormatGPX:     "application/gpx+xml",
+	FormatKML:     "application/vnd.google-earth.kml+xml",
+	FormatCSV:     "text/csv; charset=utf-8",
+}
+
+// Prepare checks the dataset, format and filter.
+func (s *ExportService) Prepare(dataset, format string, f *repositories.ExportFilter) (Export, error) {
+	switch dataset {
+	case ExportPositions, ExportTracks, ExportResults:
+	default:
+		return Export{}, invalidf("unknown dataset %q; use positions, tracks or results", dataset)
+	}
+	if format == "" {
+		format = FormatGeoJSON
+	}
+	ct, ok := exportContentTypes[format]
+	if !ok {
+		return Export{}, invalidf("unknown format %q; use geojson, gpx, kml or csv", format)
+	}
+	if f.VolunteerID != "" {
+		id, err := normalizeVolunteerID(f.VolunteerID)
+		if err != nil {
+			return Export{}, err
+		}
+		f.VolunteerID = id
+	}
+	if f.AreaID < 0 {
+		return Export{}, invalidf("invalid area id")
+	}
+	if !f.From.Before(f.To) {
+		return Export{}, invalidf("from must be before to")
+	}
+	return Export{
+		Dataset:     dataset,
+		Format:      format,
+		ContentType: ct,
+		Filename:    fmt.Sprintf("%s-%s.%s", dataset, f.To.UTC().Format("20060102T150405Z"), format),
+	}, nil
+}
+
+// Write streams the export. An error after the first row leaves w truncated;
+// the caller can only log it.
+func (s *ExportService) Write(ctx context.Context, w io.Writer, e Export, f repositories.ExportFilter) error {
+	bw := bufio.NewWriterSize(w, 64<<10)
+	var enc exportEncoder
+	switch e.Format {
+	case FormatGeoJSON:
+		enc = &geoJSONEncoder{w: bw, dataset: e.Dataset}
+	case FormatGPX:
+		enc = &gpxEncoder{w: bw, dataset: e.Dataset}
+	case FormatKML:
+		enc = &kmlEncoder{w: bw, dataset: e.Dataset}
+	default:
+		enc = &csvEncoder{w: csv.NewWriter(bw), dataset: e.Dataset}
+	}
+
+	stream := s.Repo.StreamPositions
+	switch e.Dataset {
+	case ExportTracks:
+		stream = s.Repo.StreamTrack
+	case ExportResults:
+		stream = s.Repo.StreamResults
+	}
+
+	if err := enc.begin(); err != nil {
+		return err
+	}
+	if err := stream(ctx, f, enc.row); err != nil {
+		return err
+	}
+	if err := enc.end(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+type exportEncoder interface {
+	begin() error
+	row(repositories.ExportRow) error
+	end() error
+}
+
+// exportProps lists a row's attributes for the dataset, skipping empty readings.
+func exportProps(dataset string, r repositories.ExportRow) [][2]string {
+	props := [][2]string{{"volunteerId", r.VolunteerID}, {"fullName", r.FullName}, {"time", r.Time.UTC().Format(time.RFC3339)}}
+	if dataset == ExportResults {
+		return append(props,
+			[2]string{"resultId", strconv.Itoa(r.ResultID)},
+			[2]string{"stopId", strconv.Itoa(r.StopID)},
+			[2]string{"stopName", r.StopName},
+			[2]string{"areaId", strconv.Itoa(r.AreaID)},
+			[2]string{"outcome", r.Outcome},
+			[2]string{"notes", r.Notes})
+	}
+	for _, v := range []struct {
+		name string
+		val  *float64
+	}{{"accuracy", r.Accuracy}, {"altitude", r.Altitude}, {"heading", r.Heading}, {"speed", r.Speed}, {"battery", r.Battery}} {
+		if v.val != nil {
+			props = append(props, [2]string{v.name, strconv.FormatFloat(*v.val, 'f', -1, 64)})
+		}
+	}
+	return props
+}
+
+func exportName(dataset string, r repositories.ExportRow) string {
+	name := r.FullName
+	if name == "" {
+		name = r.VolunteerID
+	}
+	if dataset == ExportResults {
+		stop := r.StopName
+		if stop == "" {
+			stop = "stop " + strconv.Itoa(r.StopID)
+		}
+		return stop + ": " + r.Outcome
+	}
+	return name
+}
+
+func coord(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+
+func xmlText(s string) string {
+	var b xmlBuffer
+	xml.EscapeText(&b, []byte(s))
+	return string(b)
+}
+
+type xmlBuffer []byte
+
+func (b *xmlBuffer) Write(p []byte) (int, error) {
+	*b = append(*b, p...)
+	return len(p), nil
+}
+
+// --- GeoJSON: one Point feature per row ---
+
+type geoJSONEncoder struct {
+	w       *bufio.Writer
+	dataset string
+	n       int
+}
+
+func (e *geoJSONEncoder) begin() error {
+	_, err := e.w.WriteString(`{"type":"FeatureCollection","features":[`)
+	return err
+}
+
+func (e *geoJSONEncoder) row(r repositories.ExportRow) error {
+	props := make(map[string]interface{})
+	for _, p := range exportProps(e.dataset, r) {
+		props[p[0]] = p[1]
+	}
+	// Keep numbers numeric for QGIS
+	props["lat"], props["lng"] = r.Lat, r.Lng
+	for _, v := range []struct {
+		name string
+		val  *float64
+	}{{"accuracy", r.Accuracy}, {"altitude", r.Altitude}, {"heading", r.Heading}, {"speed", r.Speed}, {"battery", r.Battery}} {
+		if v.val != nil {
+			props[v.name] = *v.val
+		}
+	}
+	if e.dataset == ExportResults {
+		props["resultId"], props["stopId"], props["areaId"] = r.ResultID, r.StopID, r.AreaID
+	}
+	b, err := json.Marshal(map[string]interface{}{
+		"type":       "Feature",
+		"geometry":   geometryJSON{"Point", []float64{r.Lng, r.Lat}},
+		"properties": props,
+	})
+	if err != nil {
+		return err
+	}
+	if e.n > 0 {
+		e.w.WriteByte(',')
+	}
+	e.n++
+	e.w.WriteByte('\n')
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *geoJSONEncoder) end() error {
+	_, err := e.w.WriteString("\n]}\n")
+	return err
+}
+
+// --- CSV: one line per row ---
+
+type csvEncoder struct {
+	w       *csv.Writer
+	dataset string
+}
+
+func (e *csvEncoder) columns() []string {
+	if e.dataset == ExportResults {
+		return []string{"result_id", "stop_id", "stop_name", "area_id", "volunteer_id", "full_name", "outcome", "notes", "lat", "lng", "time"}
+	}
+	return []string{"volunteer_id", "full_name", "lat", "lng", "time", "accuracy", "altitude", "heading", "speed", "battery"}
+}
+
+func (e *csvEncoder) begin() error { return e.w.Write(e.columns()) }
+
+func (e *csvEncoder) row(r repositories.ExportRow) error {
+	opt := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	t := r.Time.UTC().Format(time.RFC3339)
+	if e.dataset == ExportResults {
+		return e.w.Write([]string{strconv.Itoa(r.ResultID), strconv.Itoa(r.StopID), r.StopName, strconv.Itoa(r.AreaID),
+			r.VolunteerID, r.FullName, r.Outcome, r.Notes, coord(r.Lat), coord(r.Lng), t})
+	}
+	return e.w.Write([]string{r.VolunteerID, r.FullName, coord(r.Lat), coord(r.Lng), t,
+		opt(r.Accuracy), opt(r.Altitude), opt(r.Heading), opt(r.Speed), opt(r.Battery)})
+}
+
+func (e *csvEncoder) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// --- GPX: tracks as one trk per volunteer, everything else as waypoints ---
+
+type gpxEncoder struct {
+	w         *bufio.Writer
+	dataset   string
+	volunteer string // open trk, if any
+}
+
+func (e *gpxEncoder) begin() error {
+	_, err := e.w.WriteString(xml.Header + `<gpx version="1.1" creator="Altrinity" xmlns="http://www.topografix.com/GPX/1/1">` + "\n")
+	return err
+}
+
+func (e *gpxEncoder) row(r repositories.ExportRow) error {
+	t := r.Time.UTC().Format(time.RFC3339)
+	if e.dataset != ExportTracks {
+		desc := ""
+		for _, p := range exportProps(e.dataset, r) {
+			desc += p[0] + "=" + p[1] + "; "
+		}
+		_, err := fmt.Fprintf(e.w, "<wpt lat=\"%s\" lon=\"%s\"><time>%s</time><name>%s</name><desc>%s</desc></wpt>\n",
+			coord(r.Lat), coord(r.Lng), t, xmlText(exportName(e.dataset, r)), xmlText(desc))
+		return err
+	}
+	if r.VolunteerID != e.volunteer {
+		if e.volunteer != "" {
+			e.w.WriteString("</trkseg></trk>\n")
+		}
+		e.volunteer = r.VolunteerID
+		fmt.Fprintf(e.w, "<trk><name>%s</name><desc>%s</desc><trkseg>\n", xmlText(exportName(e.dataset, r)), xmlText(r.VolunteerID))
+	}
+	ele := ""
+	if r.Altitude != nil {
+		ele = "<ele>" + coord(*r.Altitude) + "</ele>"
+	}
+	_, err := fmt.Fprintf(e.w, "<trkpt lat=\"%s\" lon=\"%s\">%s<time>%s</time></trkpt>\n", coord(r.Lat), coord(r.Lng), ele, t)
+	return err
+}
+
+func (e *gpxEncoder) end() error {
+	if e.volunteer != "" {
+		e.w.WriteString("</trkseg></trk>\n")
+	}
+	_, err := e.w.WriteString("</gpx>\n")
+	return err
+}
+
+// --- KML: tracks as one LineString per volunteer, everything else as points ---
+
+type kmlEncoder struct {
+	w         *bufio.Writer
+	dataset   string
+	volunteer string // open LineString, if any
+}
+
+func (e *kmlEncoder) begin() error {
+	_, err := fmt.Fprintf(e.w, "%s<kml xmlns=\"http://www.opengis.net/kml/2.2\"><Document><name>%s</name>\n", xml.Header, e.dataset)
+	return err
+}
+
+func (e *kmlEncoder) row(r repositories.ExportRow) error {
+	t := r.Time.UTC().Format(time.RFC3339)
+	if e.dataset != ExportTracks {
+		e.w.WriteString("<Placemark><name>" + xmlText(exportName(e.dataset, r)) + "</name>")
+		e.w.WriteString("<TimeStamp><when>" + t + "</when></TimeStamp><ExtendedData>")
+		for _, p := range exportProps(e.dataset, r) {
+			fmt.Fprintf(e.w, "<Data name=\"%s\"><value>%s</value></Data>", p[0], xmlText(p[1]))
+		}
+		_, err := fmt.Fprintf(e.w, "</ExtendedData><Point><coordinates>%s,%s</coordinates></Point></Placemark>\n", coord(r.Lng), coord(r.Lat))
+		return err
+	}
+	if r.VolunteerID != e.volunteer {
+		e.closeTrack()
+		e.volunteer = r.VolunteerID
+		fmt.Fprintf(e.w, "<Placemark><name>%s</name><TimeSpan><begin>%s</begin></TimeSpan>"+
+			"<ExtendedData><Data name=\"volunteerId\"><value>%s</value></Data></ExtendedData><LineString><coordinates>\n",
+			xmlText(exportName(e.dataset, r)), t, xmlText(r.VolunteerID))
+	}
+	_, err := fmt.Fprintf(e.w, "%s,%s\n", coord(r.Lng), coord(r.Lat))
+	return err
+}
+
+// closeTrack ends the open LineString, if any.
+func (e *kmlEncoder) closeTrack() {
+	if e.volunteer != "" {
+		e.w.WriteString("</coordinates></LineString></Placemark>\n")
+	}
+}
+
+func (e *kmlEncoder) end() error {
+	e.closeTrack()
+	_, err := e.w.WriteString("</Document></kml>\n")
+	return err
+}
@@ -0,0 +1,30 @@
+package services
+
+// pointInRing reports whether (lng, lat) lies inside a closed GeoJSON ring,
+// using the even-odd ray casting rule on plain lng/lat coordinates. That is
+// accurate enough for turf-sized polygons away from the antimeridian.
+func pointInRing(lng, lat float64, ring [][]float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		xi, yi := ring[i][0], ring[i][1]
+		xj, yj := ring[j][0], ring[j][1]
+		if (yi > lat) != (yj > lat) && lng < (xj-xi)*(lat-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// pointInPolygon applies pointInRing to a GeoJSON polygon: inside the outer
+// ring and outside every hole.
+func pointInPolygon(lng, lat float64, rings [][][]float64) bool {
+	if len(rings) == 0 || !pointInRing(lng, lat, rings[0]) {
+		return false
+	}
+	for _, hole := range rings[1:] {
+		if pointInRing(lng, lat, hole) {
+			return false
+		}
+	}
+	return true
+}
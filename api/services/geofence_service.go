@@ -0,0 +1,137 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Geofence defaults, overridable via GEOFENCE_BUFFER_METERS and GEOFENCE_DWELL.
+const (
+	DefaultGeofenceBuffer = 100.0           // meters of slack around a turf polygon
+	DefaultGeofenceDwell  = 2 * time.Minute // time outside before an alert is raised
+	geofenceDwellCheck    = 15 * time.Second
+)
+
+// GeofenceService raises "out of turf" alerts when a volunteer with assigned
+// stops stays outside all of their areas for longer than Dwell.
+type GeofenceService struct {
+	Repo         *repositories.GeofenceRepository
+	BufferMeters float64
+	Dwell        time.Duration
+}
+
+// Check evaluates one position update, opening or clearing alerts as needed.
+// pos decides inside or outside; shown is what gets stored and put in an
+// alert, which differs from pos when the volunteer coarsens their location.
+func (s *GeofenceService) Check(ctx context.Context, pos, shown repositories.Position) error {
+	turf, err := s.Repo.CheckTurf(ctx, pos.ID, pos.Lat, pos.Lng, s.BufferMeters)
+	if err != nil {
+		return err
+	}
+
+	// No assignments means no turf to leave; treat it like being inside so
+	// unassigning a wandering volunteer also clears their alert.
+	if !turf.Assigned || turf.Inside {
+		return s.clear(ctx, pos.ID)
+	}
+
+	now := time.Now().UTC()
+	since, err := s.Repo.MarkOutside(ctx, shown, now)
+	if err != nil {
+		return err
+	}
+	return s.raise(ctx, shown, turf, since, now)
+}
+
+func (s *GeofenceService) clear(ctx context.Context, volunteerID string) error {
+	if err := s.Repo.ClearOutside(ctx, volunteerID); err != nil {
+		return err
+	}
+	alert, cleared, err := s.Repo.ClearAlert(ctx, volunteerID)
+	if err != nil || !cleared {
+		return err
+	}
+	alert.Type = repositories.GeofenceCleared
+	return s.Repo.Publish(ctx, alert)
+}
+
+// raise opens an alert at pos once the volunteer has been outside for Dwell.
+func (s *GeofenceService) raise(ctx context.Context, pos repositories.Position, turf repositories.TurfCheck, since, now time.Time) error {
+	if now.Sub(since) < s.Dwell {
+		return nil
+	}
+
+	areaID := turf.NearestAreaID
+	alert, opened, err := s.Repo.OpenAlert(ctx, repositories.GeofenceAlert{
+		VolunteerID:    pos.ID,
+		FullName:       pos.FullName,
+		AreaID:         &areaID,
+		Lat:            pos.Lat,
+		Lng:            pos.Lng,
+		DistanceMeters: turf.DistanceMeters,
+		OutsideSince:   since,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.Repo.DoneOutside(ctx, pos.ID); err != nil || !opened {
+		return err
+	}
+	alert.Type = repositories.GeofenceExited
+	return s.Repo.Publish(ctx, alert)
+}
+
+// Run raises alerts for volunteers whose dwell ran out without a further fix,
+// such as a phone that stopped sending outside the turf. It runs on every
+// instance; the open-alert index lets only one of them raise each alert.
+func (s *GeofenceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(geofenceDwellCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			now := time.Now().UTC()
+			due, err := s.Repo.DueOutside(ctx, now.Add(-s.Dwell))
+			if err != nil {
+				log.Println("geofence dwell error:", err)
+				continue
+			}
+			for _, id := range due {
+				if err := s.checkSilent(ctx, id, now); err != nil {
+					log.Println("geofence dwell error:", err)
+				}
+			}
+		}
+	}
+}
+
+// checkSilent re-checks the last fix seen outside, since assignments may have
+// changed since it arrived.
+func (s *GeofenceService) checkSilent(ctx context.Context, volunteerID string, now time.Time) error {
+	pos, since, err := s.Repo.OutsideFix(ctx, volunteerID)
+	if errors.Is(err, redis.Nil) {
+		return s.Repo.DoneOutside(ctx, volunteerID)
+	}
+	if err != nil {
+		return err
+	}
+	turf, err := s.Repo.CheckTurf(ctx, pos.ID, pos.Lat, pos.Lng, s.BufferMeters)
+	if err != nil {
+		return err
+	}
+	if !turf.Assigned || turf.Inside {
+		return s.clear(ctx, volunteerID)
+	}
+	return s.raise(ctx, pos, turf, since, now)
+}
+
+func (s *GeofenceService) ListAlerts(ctx context.Context, openOnly bool) ([]repositories.GeofenceAlert, error) {
+	return s.Repo.ListAlerts(ctx, openOnly, 500)
+}
@@ -0,0 +1,670 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Import formats.
+const (
+	FormatGeoJSON   = "geojson"
+	FormatKML       = "kml"
+	FormatKMZ       = "kmz"
+	FormatShapefile = "shapefile"
+	FormatCSV       = "csv"
+)
+
+// SourceCRS is the coordinate system an import declares. The zero value
+// means WGS 84 lng/lat, which needs no reprojection.
+type SourceCRS struct {
+	SRID int    // EPSG code
+	WKT  string // from a Shapefile .prj, when there is no EPSG code
+}
+
+func (c SourceCRS) IsWGS84() bool {
+	return c.WKT == "" && (c.SRID == 0 || c.SRID == 4326)
+}
+
+func (c SourceCRS) String() string {
+	switch {
+	case c.WKT != "":
+		return "prj"
+	case c.IsWGS84():
+		return "EPSG:4326"
+	default:
+		return fmt.Sprintf("EPSG:%d", c.SRID)
+	}
+}
+
+// importFeature is one row of an import: a geometry in the source CRS with
+// its attributes, or the reason it could not be read.
+type importFeature struct {
+	Row      int
+	Props    map[string]string
+	Geometry repositories.GeoJSON
+	Err      error
+}
+
+type geometryJSON struct {
+	Type        string      `json:"type"`
+	Coordinates interface{} `json:"coordinates"`
+}
+
+func marshalGeometry(typ string, coords interface{}) repositories.GeoJSON {
+	b, _ := json.Marshal(geometryJSON{typ, coords})
+	return b
+}
+
+// DetectFormat picks a format from a file name, falling back to sniffing
+// the first bytes.
+func DetectFormat(filename string, data []byte) string {
+	switch strings.ToLower(path.Ext(filename)) {
+	case ".geojson", ".json":
+		return FormatGeoJSON
+	case ".kml":
+		return FormatKML
+	case ".kmz":
+		return FormatKMZ
+	case ".zip", ".shp":
+		return FormatShapefile
+	case ".csv", ".txt":
+		return FormatCSV
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(data, []byte("PK")):
+		return FormatShapefile // KMZ archives are recognized inside parseZip
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatGeoJSON
+	case bytes.HasPrefix(trimmed, []byte("<")):
+		return FormatKML
+	}
+	return FormatCSV
+}
+
+// parseImport reads features from data in the given format.
+func parseImport(format string, data []byte) ([]importFeature, SourceCRS, error) {
+	switch format {
+	case FormatGeoJSON:
+		return parseGeoJSON(data)
+	case FormatKML:
+		f, err := parseKML(data)
+		return f, SourceCRS{}, err
+	case FormatKMZ, FormatShapefile:
+		return parseZip(data)
+	case FormatCSV:
+		return parseCSV(data)
+	}
+	return nil, SourceCRS{}, invalidf("unsupported format %q", format)
+}
+
+// --- GeoJSON ---
+
+type geoJSONObject struct {
+	Type       string                 `json:"type"`
+	Features   []json.RawMessage      `json:"features"`
+	Geometry   json.RawMessage        `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+	CRS        *struct {
+		Properties struct {
+			Name string `json:"name"`
+		} `json:"properties"`
+	} `json:"crs"`
+}
+
+var epsgPattern = regexp.MustCompile(`(?i)EPSG:+(?:[\d.]*:)?(\d+)$`)
+
+// parseCRSName understands the legacy GeoJSON crs names, e.g. "EPSG:2263",
+// "urn:ogc:def:crs:EPSG::2263" and "urn:ogc:def:crs:OGC:1.3:CRS84".
+func parseCRSName(name string) (SourceCRS, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.HasSuffix(strings.ToUpper(name), "CRS84") {
+		return SourceCRS{}, nil
+	}
+	m := epsgPattern.FindStringSubmatch(name)
+	if m == nil {
+		return SourceCRS{}, invalidf("unsupported crs %q; use an EPSG code", name)
+	}
+	srid, _ := strconv.Atoi(m[1])
+	return SourceCRS{SRID: srid}, nil
+}
+
+func parseGeoJSON(data []byte) ([]importFeature, SourceCRS, error) {
+	var root geoJSONObject
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, SourceCRS{}, invalidf("not valid GeoJSON: %v", err)
+	}
+	var crs SourceCRS
+	if root.CRS != nil {
+		var err error
+		if crs, err = parseCRSName(root.CRS.Properties.Name); err != nil {
+			return nil, crs, err
+		}
+	}
+
+	switch root.Type {
+	case "FeatureCollection":
+		out := make([]importFeature, 0, len(root.Features))
+		for i, raw := range root.Features {
+			f := importFeature{Row: i + 1}
+			var feat geoJSONObject
+			if err := json.Unmarshal(raw, &feat); err != nil {
+				f.Err = fmt.Errorf("not valid GeoJSON: %v", err)
+			} else {
+				f = geoJSONFeature(i+1, feat)
+			}
+			out = append(out, f)
+		}
+		return out, crs, nil
+	case "Feature":
+		return []importFeature{geoJSONFeature(1, root)}, crs, nil
+	case "":
+		return nil, crs, invalidf("GeoJSON has no type")
+	default: // a bare geometry
+		return []importFeature{{Row: 1, Geometry: data}}, crs, nil
+	}
+}
+
+func geoJSONFeature(row int, feat geoJSONObject) importFeature {
+	f := importFeature{Row: row, Props: make(map[string]string, len(feat.Properties))}
+	for k, v := range feat.Properties {
+		switch t := v.(type) {
+		case nil:
+		case string:
+			f.Props[k] = t
+		default:
+			b, _ := json.Marshal(t)
+			f.Props[k] = string(b)
+		}
+	}
+	if feat.Type != "Feature" {
+		f.Err = fmt.Errorf("expected a Feature, got %q", feat.Type)
+	} else if len(feat.Geometry) == 0 || string(feat.Geometry) == "null" {
+		f.Err = errors.New("feature has no geometry")
+	} else {
+		f.Geometry = repositories.GeoJSON(feat.Geometry)
+	}
+	return f
+}
+
+// --- KML ---
+
+type kmlPlacemark struct {
+	Name          string       `xml:"name"`
+	Description   string       `xml:"description"`
+	Data          []kmlData    `xml:"ExtendedData>Data"`
+	SimpleData    []kmlData    `xml:"ExtendedData>SchemaData>SimpleData"`
+	Point         *kmlPoint    `xml:"Point"`
+	Polygon       *kmlPolygon  `xml:"Polygon"`
+	MultiGeometry *kmlMultiGeo `xml:"MultiGeometry"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+	Text  string `xml:",chardata"`
+}
+
+type kmlPoint struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+type kmlPolygon struct {
+	Outer string   `xml:"outerBoundaryIs>LinearRing>coordinates"`
+	Inner []string `xml:"innerBoundaryIs>LinearRing>coordinates"`
+}
+
+type kmlMultiGeo struct {
+	Points   []kmlPoint   `xml:"Point"`
+	Polygons []kmlPolygon `xml:"Polygon"`
+}
+
+// parseKML returns every Placemark in the document, however deeply it is
+// nested in Folders. KML coordinates are always WGS 84.
+func parseKML(data []byte) ([]importFeature, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.CharsetReader = func(_ string, r io.Reader) (io.Reader, error) { return r, nil }
+	var out []importFeature
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, invalidf("not valid KML: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "Placemark" {
+			continue
+		}
+		var pm kmlPlacemark
+		if err := dec.DecodeElement(&pm, &start); err != nil {
+			return nil, invalidf("not valid KML: %v", err)
+		}
+		out = append(out, kmlFeature(len(out)+1, pm))
+	}
+	if len(out) == 0 {
+		return nil, invalidf("KML has no placemarks")
+	}
+	return out, nil
+}
+
+func kmlFeature(row int, pm kmlPlacemark) importFeature {
+	f := importFeature{Row: row, Props: map[string]string{}}
+	if name := strings.TrimSpace(pm.Name); name != "" {
+		f.Props["name"] = name
+	}
+	if d := strings.TrimSpace(pm.Description); d != "" {
+		f.Props["description"] = d
+	}
+	for _, d := range append(pm.Data, pm.SimpleData...) {
+		v := d.Value
+		if v == "" {
+			v = d.Text
+		}
+		f.Props[d.Name] = strings.TrimSpace(v)
+	}
+
+	var polygons [][][][]float64
+	var points [][]float64
+	var err error
+	add := func(p *kmlPolygon) {
+		if err != nil {
+			return
+		}
+		var rings [][][]float64
+		var ring [][]float64
+		if ring, err = kmlCoordinates(p.Outer); err != nil {
+			return
+		}
+		rings = append(rings, ring)
+		for _, in := range p.Inner {
+			if ring, err = kmlCoordinates(in); err != nil {
+				return
+			}
+			rings = append(rings, ring)
+		}
+		polygons = append(polygons, rings)
+	}
+	addPoint := func(p *kmlPoint) {
+		if err != nil {
+			return
+		}
+		var c [][]float64
+		if c, err = kmlCoordinates(p.Coordinates); err == nil {
+			if len(c) != 1 {
+				err = fmt.Errorf("point has %d positions", len(c))
+				return
+			}
+			points = append(points, c[0])
+		}
+	}
+	if pm.Polygon != nil {
+		add(pm.Polygon)
+	}
+	if pm.Point != nil {
+		addPoint(pm.Point)
+	}
+	if pm.MultiGeometry != nil {
+		for i := range pm.MultiGeometry.Polygons {
+			add(&pm.MultiGeometry.Polygons[i])
+		}
+		for i := range pm.MultiGeometry.Points {
+			addPoint(&pm.MultiGeometry.Points[i])
+		}
+	}
+
+	switch {
+	case err != nil:
+		f.Err = err
+	case len(polygons) > 0 && len(points) > 0:
+		f.Err = errors.New("placemark mixes points and polygons")
+	case len(polygons) == 1:
+		f.Geometry = marshalGeometry("Polygon", polygons[0])
+	case len(polygons) > 1:
+		f.Geometry = marshalGeometry("MultiPolygon", polygons)
+	case len(points) == 1:
+		f.Geometry = marshalGeometry("Point", points[0])
+	case len(points) > 1:
+		f.Geometry = marshalGeometry("MultiPoint", points)
+	default:
+		f.Err = errors.New("placemark has no point or polygon")
+	}
+	return f
+}
+
+// kmlCoordinates parses "lng,lat[,alt] lng,lat[,alt] ...", dropping altitude.
+func kmlCoordinates(s string) ([][]float64, error) {
+	var out [][]float64
+	for _, tuple := range strings.Fields(s) {
+		parts := strings.Split(tuple, ",")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("bad coordinate %q", tuple)
+		}
+		lng, err1 := strconv.ParseFloat(parts[0], 64)
+		lat, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("bad coordinate %q", tuple)
+		}
+		out = append(out, []float64{lng, lat})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("empty coordinates")
+	}
+	return out, nil
+}
+
+// --- Zip archives: Shapefile or KMZ ---
+
+func parseZip(data []byte) ([]importFeature, SourceCRS, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, SourceCRS{}, invalidf("not a valid zip archive: %v", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || strings.HasPrefix(path.Base(f.Name), ".") || strings.HasPrefix(f.Name, "__MACOSX/") {
+			continue
+		}
+		ext := strings.ToLower(path.Ext(f.Name))
+		if _, dup := files[ext]; dup && (ext == ".shp" || ext == ".kml") {
+			return nil, SourceCRS{}, invalidf("archive holds more than one %s file; import one layer at a time", ext)
+		}
+		files[ext] = f
+	}
+	read := func(ext string) ([]byte, error) {
+		f, ok := files[ext]
+		if !ok {
+			return nil, nil
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, MaxImportBytes+1))
+	}
+
+	if files[".shp"] == nil {
+		if files[".kml"] == nil {
+			return nil, SourceCRS{}, invalidf("archive has no .shp or .kml file")
+		}
+		kml, err := read(".kml")
+		if err != nil {
+			return nil, SourceCRS{}, invalidf("cannot read kml: %v", err)
+		}
+		f, err := parseKML(kml)
+		return f, SourceCRS{}, err
+	}
+
+	shp, err := read(".shp")
+	if err != nil {
+		return nil, SourceCRS{}, invalidf("cannot read shp: %v", err)
+	}
+	dbf, err := read(".dbf")
+	if err != nil {
+		return nil, SourceCRS{}, invalidf("cannot read dbf: %v", err)
+	}
+	prj, err := read(".prj")
+	if err != nil {
+		return nil, SourceCRS{}, invalidf("cannot read prj: %v", err)
+	}
+
+	features, err := parseShp(shp)
+	if err != nil {
+		return nil, SourceCRS{}, err
+	}
+	if dbf != nil {
+		records, err := parseDBF(dbf)
+		if err != nil {
+			return nil, SourceCRS{}, err
+		}
+		for i := range features {
+			if i < len(records) {
+				features[i].Props = records[i]
+			}
+		}
+	}
+	return features, prjCRS(string(prj)), nil
+}
+
+// prjCRS treats a geographic WGS 84 .prj as needing no reprojection and
+// hands anything else to PostGIS as WKT.
+func prjCRS(wkt string) SourceCRS {
+	wkt = strings.TrimSpace(wkt)
+	upper := strings.ToUpper(wkt)
+	if wkt == "" || (strings.HasPrefix(upper, "GEOGCS") &&
+		(strings.Contains(upper, "WGS_1984") || strings.Contains(upper, "WGS 84"))) {
+		return SourceCRS{}
+	}
+	return SourceCRS{WKT: wkt}
+}
+
+// parseShp reads Point, MultiPoint and Polygon shapes (with or without Z/M).
+// Polygon rings follow the Shapefile convention: clockwise rings are outer
+// boundaries and the counter-clockwise rings after one are its holes.
+func parseShp(data []byte) ([]importFeature, error) {
+	if len(data) < 100 || binary.BigEndian.Uint32(data[0:4]) != 9994 {
+		return nil, invalidf("not a valid .shp file")
+	}
+	var out []importFeature
+	for off := 100; off+8 <= len(data); {
+		row := len(out) + 1
+		length := int(binary.BigEndian.Uint32(data[off+4:off+8])) * 2
+		start, end := off+8, off+8+length
+		off = end
+		if end > len(data) || length < 4 {
+			out = append(out, importFeature{Row: row, Err: errors.New("truncated shape record")})
+			break
+		}
+		geom, err := parseShape(data[start:end])
+		out = append(out, importFeature{Row: row, Geometry: geom, Err: err})
+	}
+	return out, nil
+}
+
+func parseShape(rec []byte) (repositories.GeoJSON, error) {
+	le := binary.LittleEndian
+	f64 := func(b []byte) float64 { return math.Float64frombits(le.Uint64(b)) }
+	typ := le.Uint32(rec[0:4])
+	switch typ {
+	case 0:
+		return nil, errors.New("null shape")
+	case 1, 11, 21: // Point, PointZ, PointM
+		if len(rec) < 20 {
+			return nil, errors.New("truncated point")
+		}
+		return marshalGeometry("Point", []float64{f64(rec[4:]), f64(rec[12:])}), nil
+	case 8, 18, 28: // MultiPoint
+		if len(rec) < 40 {
+			return nil, errors.New("truncated multipoint")
+		}
+		n := int(le.Uint32(rec[36:40]))
+		if len(rec) < 40+16*n {
+			return nil, errors.New("truncated multipoint")
+		}
+		pts := make([][]float64, n)
+		for i := range pts {
+			p := rec[40+16*i:]
+			pts[i] = []float64{f64(p), f64(p[8:])}
+		}
+		return marshalGeometry("MultiPoint", pts), nil
+	case 5, 15, 25: // Polygon, PolygonZ, PolygonM
+		if len(rec) < 44 {
+			return nil, errors.New("truncated polygon")
+		}
+		numParts, numPoints := int(le.Uint32(rec[36:40])), int(le.Uint32(rec[40:44]))
+		ptsAt := 44 + 4*numParts
+		if numParts < 1 || len(rec) < ptsAt+16*numPoints {
+			return nil, errors.New("truncated polygon")
+		}
+		var polygons [][][][]float64
+		for i := 0; i < numParts; i++ {
+			from, to := int(le.Uint32(rec[44+4*i:])), numPoints
+			if i+1 < numParts {
+				to = int(le.Uint32(rec[44+4*(i+1):]))
+			}
+			if from < 0 || to > numPoints || from >= to {
+				return nil, errors.New("bad polygon part")
+			}
+			ring := make([][]float64, 0, to-from)
+			for j := from; j < to; j++ {
+				p := rec[ptsAt+16*j:]
+				ring = append(ring, []float64{f64(p), f64(p[8:])})
+			}
+			if ringArea(ring) <= 0 || len(polygons) == 0 { // clockwise: a new outer ring
+				polygons = append(polygons, [][][]float64{ring})
+			} else {
+				last := len(polygons) - 1
+				polygons[last] = append(polygons[last], ring)
+			}
+		}
+		if len(polygons) == 1 {
+			return marshalGeometry("Polygon", polygons[0]), nil
+		}
+		return marshalGeometry("MultiPolygon", polygons), nil
+	}
+	return nil, fmt.Errorf("unsupported shape type %d", typ)
+}
+
+// ringArea is the shoelace signed area: negative for clockwise rings.
+func ringArea(ring [][]float64) float64 {
+	a := 0.0
+	for i := 0; i+1 < len(ring); i++ {
+		a += ring[i][0]*ring[i+1][1] - ring[i+1][0]*ring[i][1]
+	}
+	return a / 2
+}
+
+// parseDBF reads a dBase III attribute table into one map per record.
+func parseDBF(data []byte) ([]map[string]string, error) {
+	if len(data) < 32 {
+		return nil, invalidf("not a valid .dbf file")
+	}
+	le := binary.LittleEndian
+	numRecords := int(le.Uint32(data[4:8]))
+	headerLen, recordLen := int(le.Uint16(data[8:10])), int(le.Uint16(data[10:12]))
+	type field struct {
+		name   string
+		offset int
+		length int
+	}
+	var fields []field
+	offset := 1 // deletion flag
+	for p := 32; p+32 <= len(data) && p < headerLen && data[p] != 0x0D; p += 32 {
+		name := string(bytes.TrimRight(data[p:p+11], "\x00 "))
+		length := int(data[p+16])
+		fields = append(fields, field{name, offset, length})
+		offset += length
+	}
+
+	out := make([]map[string]string, 0, numRecords)
+	for i := 0; i < numRecords; i++ {
+		start := headerLen + i*recordLen
+		if start+recordLen > len(data) {
+			break
+		}
+		rec := data[start : start+recordLen]
+		m := make(map[string]string, len(fields))
+		for _, f := range fields {
+			if f.offset+f.length > len(rec) {
+				continue
+			}
+			m[f.name] = strings.TrimSpace(decodeDBFText(rec[f.offset : f.offset+f.length]))
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// decodeDBFText keeps UTF-8 as is and reads anything else as Latin-1, the
+// usual encoding of older county exports.
+func decodeDBFText(b []byte) string {
+	if utf8.Valid(b) {
+		return string(b)
+	}
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// --- CSV ---
+
+var (
+	csvLatColumns = []string{"lat", "latitude", "y"}
+	csvLngColumns = []string{"lng", "lon", "long", "longitude", "x"}
+)
+
+// parseCSV reads points from a CSV with a header row. Every column is kept
+// as a property; rows are numbered by line.
+func parseCSV(data []byte) ([]importFeature, SourceCRS, error) {
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if err != nil {
+		return nil, SourceCRS{}, invalidf("cannot read CSV header: %v", err)
+	}
+	find := func(names []string) int {
+		for _, n := range names {
+			for i, h := range header {
+				if strings.EqualFold(strings.TrimSpace(h), n) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	latCol, lngCol := find(csvLatColumns), find(csvLngColumns)
+	if latCol < 0 || lngCol < 0 {
+		return nil, SourceCRS{}, invalidf("CSV needs latitude and longitude columns (e.g. lat, lng)")
+	}
+
+	var out []importFeature
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		f := importFeature{Row: line, Props: map[string]string{}}
+		if err != nil {
+			f.Err = err
+			out = append(out, f)
+			continue
+		}
+		for i, h := range header {
+			if i < len(rec) {
+				f.Props[strings.TrimSpace(h)] = strings.TrimSpace(rec[i])
+			}
+		}
+		if latCol >= len(rec) || lngCol >= len(rec) {
+			f.Err = errors.New("missing coordinates")
+		} else {
+			lat, err1 := strconv.ParseFloat(strings.TrimSpace(rec[latCol]), 64)
+			lng, err2 := strconv.ParseFloat(strings.TrimSpace(rec[lngCol]), 64)
+			if err1 != nil || err2 != nil {
+				f.Err = fmt.Errorf("coordinates are not numbers: %q, %q", rec[latCol], rec[lngCol])
+			} else {
+				f.Geometry = marshalGeometry("Point", []float64{lng, lat})
+			}
+		}
+		out = append(out, f)
+	}
+	return out, SourceCRS{}, nil
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+)
+
+// shpRecord builds the content of one shape record (without the record header).
+func shpRecord(typ uint32, body ...interface{}) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, typ)
+	for _, v := range body {
+		binary.Write(&b, binary.LittleEndian, v)
+	}
+	return b.Bytes()
+}
+
+func shpPoint(typ uint32, x, y float64, extra ...float64) []byte {
+	return shpRecord(typ, append([]float64{x, y}, extra...))
+}
+
+func shpMultiPoint(pts ...[2]float64) []byte {
+	flat := make([]float64, 0, 2*len(pts))
+	for _, p := range pts {
+		flat = append(flat, p[0], p[1])
+	}
+	return shpRecord(8, [4]float64{}, uint32(len(pts)), flat)
+}
+
+// shpPolygon builds a Polygon record from rings given as closed point lists.
+func shpPolygon(rings ...[][2]float64) []byte {
+	var parts []uint32
+	var flat []float64
+	n := 0
+	for _, r := range rings {
+		parts = append(parts, uint32(n))
+		for _, p := range r {
+			flat = append(flat, p[0], p[1])
+		}
+		n += len(r)
+	}
+	return shpRecord(5, [4]float64{}, uint32(len(rings)), uint32(n), parts, flat)
+}
+
+// shpFile wraps records in a .shp header and record headers.
+func shpFile(records ...[]byte) []byte {
+	var b bytes.Buffer
+	header := make([]byte, 100)
+	binary.BigEndian.PutUint32(header[0:4], 9994)
+	b.Write(header)
+	for i, rec := range records {
+		binary.Write(&b, binary.BigEndian, uint32(i+1))
+		binary.Write(&b, binary.BigEndian, uint32(len(rec)/2))
+		b.Write(rec)
+	}
+	return b.Bytes()
+}
+
+type dbfField struct {
+	name   string
+	length int
+}
+
+// dbfFile builds a dBase III table of character fields.
+func dbfFile(fields []dbfField, records [][]string) []byte {
+	recordLen := 1
+	for _, f := range fields {
+		recordLen += f.length
+	}
+	headerLen := 32 + 32*len(fields) + 1
+
+	var b bytes.Buffer
+	head := make([]byte, 32)
+	head[0] = 3
+	binary.LittleEndian.PutUint32(head[4:8], uint32(len(records)))
+	binary.LittleEndian.PutUint16(head[8:10], uint16(headerLen))
+	binary.LittleEndian.PutUint16(head[10:12], uint16(recordLen))
+	b.Write(head)
+	for _, f := range fields {
+		desc := make([]byte, 32)
+		copy(desc, f.name)
+		desc[11] = 'C'
+		desc[16] = byte(f.length)
+		b.Write(desc)
+	}
+	b.WriteByte(0x0D)
+	for _, rec := range records {
+		b.WriteByte(' ')
+		for i, f := range fields {
+			v := []byte(rec[i])
+			b.Write(v)
+			b.Write(bytes.Repeat([]byte{' '}, f.length-len(v)))
+		}
+	}
+	b.WriteByte(0x1A)
+	return b.Bytes()
+}
+
+var (
+	square   = [][2]float64{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}} // clockwise
+	hole     = [][2]float64{{2, 2}, {4, 2}, {4, 4}, {2, 4}, {2, 2}}     // counter-clockwise
+	farAway  = [][2]float64{{20, 0}, {20, 5}, {25, 5}, {25, 0}, {20, 0}}
+	ringJSON = `[[0,0],[0,10],[10,10],[10,0],[0,0]]`
+)
+
+func TestParseShape(t *testing.T) {
+	tests := []struct {
+		name    string
+		rec     []byte
+		want    string
+		wantErr string
+	}{
+		{"point", shpPoint(1, -73.5, 40.25), `{"type":"Point","coordinates":[-73.5,40.25]}`, ""},
+		{"point z", shpPoint(11, 1, 2, 30, 0), `{"type":"Point","coordinates":[1,2]}`, ""},
+		{"point m", shpPoint(21, 1, 2, 5), `{"type":"Point","coordinates":[1,2]}`, ""},
+		{"multipoint", shpMultiPoint([2]float64{1, 2}, [2]float64{3, 4}), `{"type":"MultiPoint","coordinates":[[1,2],[3,4]]}`, ""},
+		{"polygon", shpPolygon(square), `{"type":"Polygon","coordinates":[` + ringJSON + `]}`, ""},
+		{"polygon with hole", shpPolygon(square, hole),
+			`{"type":"Polygon","coordinates":[` + ringJSON + `,[[2,2],[4,2],[4,4],[2,4],[2,2]]]}`, ""},
+		{"two outer rings", shpPolygon(square, farAway),
+			`{"type":"MultiPolygon","coordinates":[[` + ringJSON + `],[[[20,0],[20,5],[25,5],[25,0],[20,0]]]]}`, ""},
+		{"null shape", shpRecord(0), "", "null shape"},
+		{"truncated point", shpRecord(1, 1.0), "", "truncated point"},
+		{"truncated multipoint", shpRecord(8, [4]float64{}, uint32(3), [2]float64{1, 2}), "", "truncated multipoint"},
+		{"truncated polygon", shpRecord(5, [4]float64{}, uint32(1), uint32(5)), "", "truncated polygon"},
+		{"bad part index", shpRecord(5, [4]float64{}, uint32(2), uint32(2), []uint32{0, 7}, [4]float64{}), "", "bad polygon part"},
+		{"polyline", shpRecord(3, [4]float64{}), "", "unsupported shape type 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseShape(tt.rec)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRingArea(t *testing.T) {
+	tests := []struct {
+		name string
+		ring [][]float64
+		want float64
+	}{
+		{"clockwise", [][]float64{{0, 0}, {0, 10}, {10, 10}, {10, 0}, {0, 0}}, -100},
+		{"counter-clockwise", [][]float64{{0, 0}, {10, 0}, {10, 10}, {0, 10}, {0, 0}}, 100},
+		{"triangle", [][]float64{{0, 0}, {4, 0}, {0, 3}, {0, 0}}, 6},
+		{"degenerate", [][]float64{{0, 0}, {1, 1}, {0, 0}}, 0},
+		{"empty", nil, 0},
+	}
+	for _, tt := range tests {
+		if got := ringArea(tt.ring); got != tt.want {
+			t.Errorf("%s: ringArea = %g, want %g", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseShp(t *testing.T) {
+	if _, err := parseShp([]byte("not a shapefile")); err == nil {
+		t.Error("expected an error for a short file")
+	}
+	bad := shpFile()
+	binary.BigEndian.PutUint32(bad[0:4], 1234)
+	if _, err := parseShp(bad); err == nil {
+		t.Error("expected an error for a bad file code")
+	}
+
+	data := shpFile(shpPoint(1, 1, 2), shpRecord(0), shpPoint(1, 3, 4))
+	got, err := parseShp(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d features, want 3", len(got))
+	}
+	for i, f := range got {
+		if f.Row != i+1 {
+			t.Errorf("feature %d has row %d", i, f.Row)
+		}
+	}
+	if got[1].Err == nil || got[0].Err != nil || got[2].Err != nil {
+		t.Errorf("only the null shape should fail: %v, %v, %v", got[0].Err, got[1].Err, got[2].Err)
+	}
+
+	// A record whose length runs past the end of the file
+	truncated := shpFile(shpPoint(1, 1, 2), shpPoint(1, 3, 4))
+	truncated = truncated[:len(truncated)-8]
+	got, err = parseShp(truncated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].Err != nil || got[1].Err == nil {
+		t.Errorf("want one good feature and one truncated, got %+v", got)
+	}
+}
+
+func TestParseDBF(t *testing.T) {
+	fields := []dbfField{{"NAME", 12}, {"HOUSE_NO", 5}}
+	data := dbfFile(fields, [][]string{
+		{"Elm St", "12"},
+		{"Caf\xe9 Row", "3A"}, // Latin-1
+		{"", ""},
+	})
+	got, err := parseDBF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]string{
+		{"NAME": "Elm St", "HOUSE_NO": "12"},
+		{"NAME": "Café Row", "HOUSE_NO": "3A"},
+		{"NAME": "", "HOUSE_NO": ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d records, want %d", len(got), len(want))
+	}
+	for i := range want {
+		for k, v := range want[i] {
+			if got[i][k] != v {
+				t.Errorf("record %d %s = %q, want %q", i, k, got[i][k], v)
+			}
+		}
+	}
+
+	// A header claiming more records than the file holds stops at the end
+	short := data[:len(data)-1-18]
+	if got, err := parseDBF(short); err != nil || len(got) != 2 {
+		t.Errorf("truncated table: got %d records, err %v; want 2", len(got), err)
+	}
+	if _, err := parseDBF([]byte("short")); err == nil {
+		t.Error("expected an error for a short file")
+	}
+}
+
+func TestParseZipShapefile(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range map[string][]byte{
+		"stops/stops.shp": shpFile(shpPoint(1, 583000, 4507000), shpPoint(1, 583100, 4507100)),
+		"stops/stops.dbf": dbfFile([]dbfField{{"NAME", 8}}, [][]string{{"a"}, {"b"}}),
+		"stops/stops.prj": []byte(`PROJCS["WGS_1984_UTM_Zone_18N",GEOGCS["GCS_WGS_1984"]]`),
+		"__MACOSX/._x":    []byte("junk"),
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	zw.Close()
+
+	features, crs, err := parseZip(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 2 || features[0].Props["NAME"] != "a" || features[1].Props["NAME"] != "b" {
+		t.Errorf("attributes not joined: %+v", features)
+	}
+	if crs.IsWGS84() || !strings.HasPrefix(crs.WKT, "PROJCS") {
+		t.Errorf("crs = %+v, want the projected .prj", crs)
+	}
+}
+
+func TestPrjCRS(t *testing.T) {
+	tests := []struct {
+		prj   string
+		wgs84 bool
+	}{
+		{"", true},
+		{`GEOGCS["GCS_WGS_1984",DATUM["D_WGS_1984"]]`, true},
+		{`GEOGCS["WGS 84",DATUM["WGS_1984"]]`, true},
+		{`GEOGCS["GCS_North_American_1983"]`, false},
+		{`PROJCS["NAD_1983_StatePlane_New_York_Long_Island",GEOGCS["GCS_North_American_1983"]]`, false},
+	}
+	for _, tt := range tests {
+		if got := prjCRS(tt.prj).IsWGS84(); got != tt.wgs84 {
+			t.Errorf("prjCRS(%q).IsWGS84() = %v, want %v", tt.prj, got, tt.wgs84)
+		}
+	}
+}
+
+func TestParseCRSName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    int
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"urn:ogc:def:crs:OGC:1.3:CRS84", 0, false},
+		{"EPSG:4326", 4326, false},
+		{"epsg:2263", 2263, false},
+		{"urn:ogc:def:crs:EPSG::2263", 2263, false},
+		{"urn:ogc:def:crs:EPSG:6.6:27700", 27700, false},
+		{"  EPSG:3857  ", 3857, false},
+		{"ESRI:102100", 0, true},
+		{"NAD83", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCRSName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseCRSName(%q) err = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got.SRID != tt.want {
+			t.Errorf("parseCRSName(%q) = %d, want %d", tt.name, got.SRID, tt.want)
+		}
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []string // geometry per row, or "error"
+		wantErr bool
+	}{
+		{"lat lng", "name,lat,lng\nA,40.5,-73.25\n", []string{`{"type":"Point","coordinates":[-73.25,40.5]}`}, false},
+		{"long names and bom", "\xef\xbb\xbfLatitude, Longitude\n1,2\n", []string{`{"type":"Point","coordinates":[2,1]}`}, false},
+		{"x y", "Y,X\n10,20\n", []string{`{"type":"Point","coordinates":[20,10]}`}, false},
+		{"bad rows", "lat,lng\nabc,1\n5\n3,4\n",
+			[]string{"error", "error", `{"type":"Point","coordinates":[4,3]}`}, false},
+		{"no coordinate columns", "name,address\nA,1 Main St\n", nil, true},
+		{"empty", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := parseCSV([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rows, want %d", len(got), len(tt.want))
+			}
+			for i, f := range got {
+				if f.Row != i+2 {
+					t.Errorf("row %d numbered %d, want line %d", i, f.Row, i+2)
+				}
+				if tt.want[i] == "error" {
+					if f.Err == nil {
+						t.Errorf("row %d: expected an error", i)
+					}
+					continue
+				}
+				if f.Err != nil || string(f.Geometry) != tt.want[i] {
+					t.Errorf("row %d: got %s (%v), want %s", i, f.Geometry, f.Err, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCSVKeepsProperties(t *testing.T) {
+	got, _, err := parseCSV([]byte("lat,lng, Name \n1,2, Elm St \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got[0].Props["Name"] != "Elm St" || featureName(got[0], "") != "Elm St" {
+		t.Errorf("props = %v", got[0].Props)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		data     string
+		want     string
+	}{
+		{"turfs.geojson", "", FormatGeoJSON},
+		{"turfs.KML", "", FormatKML},
+		{"turfs.kmz", "", FormatKMZ},
+		{"parcels.zip", "", FormatShapefile},
+		{"doors.csv", "", FormatCSV},
+		{"", "PK\x03\x04", FormatShapefile},
+		{"", "  {\"type\":\"FeatureCollection\"}", FormatGeoJSON},
+		{"", "<?xml version=\"1.0\"?><kml/>", FormatKML},
+		{"", "lat,lng\n1,2", FormatCSV},
+	}
+	for _, tt := range tests {
+		if got := DetectFormat(tt.filename, []byte(tt.data)); got != tt.want {
+			t.Errorf("DetectFormat(%q, %q) = %s, want %s", tt.filename, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestLooksProjected(t *testing.T) {
+	if looksProjected(-73.9, 40.7) || !looksProjected(583000, 4507000) || !looksProjected(0, math.Inf(1)) {
+		t.Error("looksProjected misclassified a coordinate")
+	}
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Import limits.
+const (
+	MaxImportBytes = 50 << 20
+	MaxImportRows  = 20000
+)
+
+// Import row outcomes.
+const (
+	RowCreated = "created"
+	RowValid   = "valid" // dry run: would have been created
+	RowError   = "error"
+)
+
+// ImportService loads turf boundaries into areas and door lists into stops
+// from GeoJSON, KML/KMZ, zipped Shapefiles and CSV. Each row is checked and
+// stored on its own, so one bad row is reported without losing the rest.
+type ImportService struct {
+	Areas *AreaService
+	Stops *StopService
+}
+
+// ImportOptions control an import. Format is detected from Filename and the
+// content when empty. SRID overrides the CRS the file declares. NameField
+// picks the attribute used for names; by default the first of name, title,
+// label or address that is present.
+type ImportOptions struct {
+	Format    string
+	Filename  string
+	SRID      int
+	NameField string
+	DryRun    bool
+}
+
+type ImportRow struct {
+	Row    int    `json:"row"`
+	Name   string `json:"name,omitempty"`
+	Status string `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	Format   string      `json:"format"`
+	CRS      string      `json:"crs"`
+	DryRun   bool        `json:"dryRun"`
+	Total    int         `json:"total"`
+	Imported int         `json:"imported"`
+	Failed   int         `json:"failed"`
+	Rows     []ImportRow `json:"rows"`
+}
+
+var defaultNameFields = []string{"name", "title", "label", "address"}
+
+func (r *ImportReport) add(row ImportRow) {
+	r.Rows = append(r.Rows, row)
+	r.Total++
+	if row.Status == RowError {
+		r.Failed++
+	} else {
+		r.Imported++
+	}
+}
+
+// read parses the upload and reprojects each feature to EPSG:4326.
+func (s *ImportService) read(ctx context.Context, data []byte, opts ImportOptions) ([]importFeature, ImportReport, error) {
+	report := ImportReport{DryRun: opts.DryRun, Rows: []ImportRow{}}
+	if len(data) == 0 {
+		return nil, report, invalidf("file is empty")
+	}
+	if len(data) > MaxImportBytes {
+		return nil, report, invalidf("file is larger than %d MB", MaxImportBytes>>20)
+	}
+	format := strings.ToLower(strings.TrimSpace(opts.Format))
+	if format == "" {
+		format = DetectFormat(opts.Filename, data)
+	}
+	report.Format = format
+
+	features, crs, err := parseImport(format, data)
+	if err != nil {
+		return nil, report, err
+	}
+	if len(features) > MaxImportRows {
+		return nil, report, invalidf("too many rows: %d (max %d)", len(features), MaxImportRows)
+	}
+	if opts.SRID != 0 {
+		crs = SourceCRS{SRID: opts.SRID}
+	}
+	report.CRS = crs.String()
+
+	if !crs.IsWGS84() {
+		for i := range features {
+			f := &features[i]
+			if f.Err != nil {
+				continue
+			}
+			g, err := s.Areas.Repo.Reproject(ctx, f.Geometry, crs.SRID, crs.WKT)
+			if err != nil {
+				f.Err = fmt.Errorf("cannot reproject from %s: %v", crs, err)
+				continue
+			}
+			f.Geometry = g
+		}
+	}
+	return features, report, nil
+}
+
+func featureName(f importFeature, field string) string {
+	if field != "" {
+		return strings.TrimSpace(f.Props[field])
+	}
+	for _, want := range defaultNameFields {
+		for k, v := range f.Props {
+			if strings.EqualFold(k, want) && strings.TrimSpace(v) != "" {
+				return strings.TrimSpace(v)
+			}
+		}
+	}
+	return ""
+}
+
+// looksProjected catches projected coordinates in a file that declared no
+// CRS, where the real fix is to pass an SRID.
+func looksProjected(lng, lat float64) bool {
+	return math.Abs(lng) > 180 || math.Abs(lat) > 90
+}
+
+// ImportAreas creates an area per polygon. A multipolygon becomes one area
+// per part, named "name (n)". Unnamed features are named after their row.
+func (s *ImportService) ImportAreas(ctx context.Context, data []byte, opts ImportOptions) (ImportReport, error) {
+	features, report, err := s.read(ctx, data, opts)
+	if err != nil {
+		return report, err
+	}
+
+	for _, f := range features {
+		name := featureName(f, opts.NameField)
+		if name == "" {
+			name = fmt.Sprintf("Imported area %d", f.Row)
+		}
+		if f.Err != nil {
+			report.add(ImportRow{Row: f.Row, Name: name, Status: RowError, Error: f.Err.Error()})
+			continue
+		}
+
+		var g struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		}
+		if err := json.Unmarshal(f.Geometry, &g); err != nil {
+			report.add(ImportRow{Row: f.Row, Name: name, Status: RowError, Error: "geometry is not valid GeoJSON"})
+			continue
+		}
+		var polygons []repositories.GeoJSON
+		switch g.Type {
+		case "Polygon":
+			polygons = append(polygons, f.Geometry)
+		case "MultiPolygon":
+			var parts [][][][]float64
+			if err := json.Unmarshal(g.Coordinates, &parts); err != nil {
+				report.add(ImportRow{Row: f.Row, Name: name, Status: RowError, Error: "multipolygon is malformed"})
+				continue
+			}
+			for _, p := range parts {
+				polygons = append(polygons, marshalGeometry("Polygon", p))
+			}
+		default:
+			report.add(ImportRow{Row: f.Row, Name: name, Status: RowError, Error: fmt.Sprintf("expected a polygon, got %s", g.Type)})
+			continue
+		}
+
+		for i, polygon := range polygons {
+			partName := name
+			if len(polygons) > 1 {
+				partName = fmt.Sprintf("%s (%d)", name, i+1)
+			}
+			report.add(s.importArea(ctx, f.Row, partName, polygon, opts.DryRun))
+		}
+	}
+	return report, nil
+}
+
+func (s *ImportService) importArea(ctx context.Context, row int, name string, polygon repositories.GeoJSON, dryRun bool) ImportRow {
+	out := ImportRow{Row: row, Name: name}
+	fail := func(err error) ImportRow {
+		out.Status, out.Error = RowError, err.Error()
+		return out
+	}
+
+	clean, err := s.Areas.validatePolygon(ctx, polygon)
+	if err != nil {
+		if _, rings, _ := normalizePolygon(polygon); len(rings) > 0 && len(rings[0]) > 0 && looksProjected(rings[0][0][0], rings[0][0][1]) {
+			return fail(fmt.Errorf("%v; the file may use a projected CRS, set srid", err))
+		}
+		return fail(err)
+	}
+	if dryRun {
+		out.Status = RowValid
+		return out
+	}
+	area, err := s.Areas.Repo.CreateArea(ctx, name, clean)
+	if err != nil {
+		return fail(err)
+	}
+	out.Status, out.ID = RowCreated, area.ID
+	return out
+}
+
+// ImportStops adds every point to the area as a stop. A multipoint adds one
+// stop per point.
+func (s *ImportService) ImportStops(ctx context.Context, areaID int, data []byte, opts ImportOptions) (ImportReport, error) {
+	if _, err := s.Areas.GetArea(ctx, areaID); err != nil {
+		return ImportReport{}, err
+	}
+	features, report, err := s.read(ctx, data, opts)
+	if err != nil {
+		return report, err
+	}
+
+	for _, f := range features {
+		name := featureName(f, opts.NameField)
+		if f.Err != nil {
+			report.add(ImportRow{Row: f.Row, Name: name, Status: RowError, Error: f.Err.Error()})
+			continue
+		}
+
+		var g struct {
+			Type        string          `json:"type"`
+			Coordinates json.RawMessage `json:"coordinates"`
+		}
+		var points [][]float64
+		err := json.Unmarshal(f.Geometry, &g)
+		switch {
+		case err != nil:
+		case g.Type == "Point":
+			var p []float64
+			if err = json.Unmarshal(g.Coordinates, &p); err == nil {
+				points = [][]float64{p}
+			}
+		case g.Type == "MultiPoint":
+			err = json.Unmarshal(g.Coordinates, &points)
+		default:
+			report.add(ImportRow{Row: f.Row, Name: name, Status: RowError, Error: fmt.Sprintf("expected a point, got %s", g.Type)})
+			continue
+		}
+		if err != nil {
+			report.add(ImportRow{Row: f.Row, Name: name, Status: RowError, Error: "point is malformed"})
+			continue
+		}
+
+		for _, p := range points {
+			report.add(s.importStop(ctx, areaID, f.Row, name, p, opts.DryRun))
+		}
+	}
+	return report, nil
+}
+
+func (s *ImportService) importStop(ctx context.Context, areaID, row int, name string, p []float64, dryRun bool) ImportRow {
+	out := ImportRow{Row: row, Name: name}
+	if len(p) < 2 {
+		out.Status, out.Error = RowError, "point must be [lng, lat]"
+		return out
+	}
+	stop := repositories.Stop{Name: name, Lng: p[0], Lat: p[1]}
+	if err := validateStop(row, stop); err != nil {
+		out.Status, out.Error = RowError, err.Error()
+		if looksProjected(stop.Lng, stop.Lat) {
+			out.Error += "; the file may use a projected CRS, set srid"
+		}
+		return out
+	}
+	if dryRun {
+		out.Status = RowValid
+		return out
+	}
+	created, err := s.Stops.createStop(ctx, areaID, stop)
+	if err != nil {
+		out.Status, out.Error = RowError, err.Error()
+		return out
+	}
+	out.Status, out.ID = RowCreated, created.ID
+	return out
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"log"
+	"time"
+)
+
+// Presence defaults, overridable via PRESENCE_IDLE_AFTER, PRESENCE_STALE_AFTER
+// and PRESENCE_OFFLINE_AFTER.
+const (
+	DefaultPresenceIdleAfter    = 10 * time.Minute // no movement beyond PresenceMoveMeters
+	DefaultPresenceStaleAfter   = 5 * time.Minute  // no fix at all
+	DefaultPresenceOfflineAfter = 30 * time.Minute // no fix at all
+	PresenceMoveMeters          = 30.0             // smaller shifts are GPS drift, not movement
+	PresenceSweepInterval       = 30 * time.Second
+	PresenceRetention           = 24 * time.Hour // offline records are forgotten after this
+	presenceCASAttempts         = 3
+)
+
+// PresenceService derives each volunteer's status from when they were last
+// seen and last moved. Fixes update it through Touch; Run sweeps periodically
+// so volunteers who stop reporting go stale and offline on their own. Every
+// transition is appended to the admin live feed.
+type PresenceService struct {
+	Repo         *repositories.PresenceRepository
+	IdleAfter    time.Duration
+	StaleAfter   time.Duration
+	OfflineAfter time.Duration
+}
+
+// status computes what rec's status is at now.
+func (s *PresenceService) status(rec repositories.PresenceRecord, now time.Time) string {
+	switch {
+	case now.Sub(rec.LastSeen) > s.OfflineAfter:
+		return repositories.PresenceOffline
+	case now.Sub(rec.LastSeen) > s.StaleAfter:
+		return repositories.PresenceStale
+	case now.Sub(rec.MovedAt) > s.IdleAfter:
+		return repositories.PresenceIdle
+	default:
+		return repositories.PresenceActive
+	}
+}
+
+// Touch records an accepted fix.
+func (s *PresenceService) Touch(ctx context.Context, pos repositories.Position) error {
+	seen := pos.UpdatedAt
+	for i := 0; i < presenceCASAttempts; i++ {
+		old, raw, err := s.Repo.Get(ctx, pos.ID)
+		if err != nil {
+			return err
+		}
+
+		var rec repositories.PresenceRecord
+		previous := ""
+		if old != nil {
+			rec, previous = *old, old.Status
+			if seen.Before(rec.LastSeen) {
+				return nil // an older fix from a batch upload
+			}
+		}
+		rec.VolunteerID, rec.FullName = pos.ID, pos.FullName
+		rec.LastSeen, rec.Lat, rec.Lng = seen, pos.Lat, pos.Lng
+		if old == nil || haversine(rec.AnchorLat, rec.AnchorLng, pos.Lat, pos.Lng) > PresenceMoveMeters {
+			rec.MovedAt, rec.AnchorLat, rec.AnchorLng = seen, pos.Lat, pos.Lng
+		}
+
+		ok, err := s.transition(ctx, raw, &rec, previous, time.Now().UTC())
+		if err != nil || ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// transition recomputes rec's status, stores it if nothing changed it
+// meanwhile and publishes the change if the status moved.
+func (s *PresenceService) transition(ctx context.Context, raw string, rec *repositories.PresenceRecord, previous string, now time.Time) (bool, error) {
+	rec.Status = s.status(*rec, now)
+	if rec.Status != previous {
+		rec.Since = now
+	}
+	ok, err := s.Repo.CompareAndSwap(ctx, rec.VolunteerID, raw, rec)
+	if err != nil || !ok || rec.Status == previous {
+		return ok, err
+	}
+	return true, s.Repo.Publish(ctx, repositories.PresenceChange{
+		VolunteerID: rec.VolunteerID,
+		FullName:    rec.FullName,
+		Status:      rec.Status,
+		Previous:    previous,
+		LastSeen:    rec.LastSeen,
+		Lat:         rec.Lat,
+		Lng:         rec.Lng,
+	})
+}
+
+// Sweep moves volunteers whose status decayed with time and forgets those
+// offline for longer than PresenceRetention.
+func (s *PresenceService) Sweep(ctx context.Context) error {
+	recs, raws, err := s.Repo.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for id, rec := range recs {
+		if now.Sub(rec.LastSeen) > PresenceRetention {
+			if _, err := s.Repo.CompareAndSwap(ctx, id, raws[id], nil); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.status(rec, now) == rec.Status {
+			continue
+		}
+		if _, err := s.transition(ctx, raws[id], &rec, rec.Status, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run sweeps until ctx is cancelled. Every instance may run it; the
+// compare-and-swap in transition publishes each change once.
+func (s *PresenceService) Run(ctx context.Context) {
+	ticker := time.NewTicker(PresenceSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Sweep(ctx); err != nil {
+				log.Println("presence sweep error:", err)
+			}
+		}
+	}
+}
+
+// All returns every known volunteer's presence with the status as of now,
+// so callers never see a status the sweeper hasn't caught up with yet.
+func (s *PresenceService) All(ctx context.Context) (map[string]repositories.PresenceRecord, error) {
+	recs, _, err := s.Repo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	for id, rec := range recs {
+		if st := s.status(rec, now); st != rec.Status {
+			rec.Status, rec.Since = st, now
+			recs[id] = rec
+		}
+	}
+	return recs, nil
+}
+
+// annotatePresence sets Status and LastSeen on positions from presence records.
+// Volunteers without a record are offline, last seen at their stored fix.
+func annotatePresence(positions []repositories.Position, recs map[string]repositories.PresenceRecord) {
+	for i := range positions {
+		p := &positions[i]
+		if rec, ok := recs[p.ID]; ok {
+			seen := rec.LastSeen
+			p.Status, p.LastSeen = rec.Status, &seen
+			continue
+		}
+		p.Status = repositories.PresenceOffline
+		if !p.UpdatedAt.IsZero() {
+			seen := p.UpdatedAt
+			p.LastSeen = &seen
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"math"
+	"slices"
+)
+
+const (
+	MaxCoarseMeters = 5000.0
+	metersPerDegree = 111320.0 // along a meridian
+)
+
+// PrivacyService manages each volunteer's location sharing choices. They are
+// enforced in VolunteerService before anything reaches Redis or Postgres.
+type PrivacyService struct {
+	Repo       *repositories.PrivacyRepository
+	Volunteers *repositories.VolunteerRepository
+}
+
+func (s *PrivacyService) Get(ctx context.Context, volunteerID string) (repositories.PrivacySettings, error) {
+	return s.Repo.Get(ctx, volunteerID)
+}
+
+// Update saves a volunteer's settings. Pausing or coarsening takes their
+// precise position off the live map and out of the stored latest position at
+// once, and admins are told about any change of sharing mode.
+func (s *PrivacyService) Update(ctx context.Context, p repositories.PrivacySettings) (repositories.PrivacySettings, error) {
+	if p.CoarseMeters < 0 || p.CoarseMeters > MaxCoarseMeters {
+		return p, invalidf("coarseMeters must be between 0 and %g", MaxCoarseMeters)
+	}
+	prev, err := s.Repo.Get(ctx, p.VolunteerID)
+	if err != nil {
+		return p, err
+	}
+	saved, err := s.Repo.Save(ctx, p)
+	if err != nil {
+		return saved, err
+	}
+
+	if (saved.Paused && !prev.Paused) || saved.CoarseMeters > prev.CoarseMeters {
+		if err := s.Volunteers.DeleteLivePosition(ctx, saved.VolunteerID); err != nil {
+			log.Println("clear live position error:", err)
+		}
+		if err := s.hideLatest(ctx, saved); err != nil {
+			return saved, err
+		}
+	}
+	if !slices.Equal(saved.Sharing(), prev.Sharing()) {
+		err := s.Repo.Publish(ctx, repositories.PrivacyChange{
+			VolunteerID: saved.VolunteerID,
+			FullName:    saved.FullName,
+			Sharing:     saved.Sharing(),
+		})
+		if err != nil {
+			log.Println("privacy publish error:", err)
+		}
+	}
+	return saved, nil
+}
+
+// hideLatest applies new settings to the stored latest position, which
+// admins and exports read: a paused volunteer's is removed, a coarsened
+// one's snapped to the new grid.
+func (s *PrivacyService) hideLatest(ctx context.Context, p repositories.PrivacySettings) error {
+	if p.Paused {
+		return s.Volunteers.DeleteLatestPosition(ctx, p.VolunteerID)
+	}
+	last, err := s.Volunteers.GetLastPosition(ctx, p.VolunteerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.Volunteers.ReplaceLatestPoint(ctx, coarsen(last, float64(p.CoarseMeters)))
+}
+
+// ListRestricted returns every volunteer who limits sharing, for admins.
+func (s *PrivacyService) ListRestricted(ctx context.Context) ([]repositories.PrivacySettings, error) {
+	return s.Repo.ListRestricted(ctx)
+}
+
+// shared is pos as the volunteer agreed to share it.
+func shared(pos repositories.Position, p repositories.PrivacySettings) repositories.Position {
+	if p.CoarseMeters > 0 {
+		return coarsen(pos, float64(p.CoarseMeters))
+	}
+	return pos
+}
+
+// coarsen snaps a fix to a grid of roughly meters-sized cells and drops the
+// readings that would give a finer position away.
+func coarsen(pos repositories.Position, meters float64) repositories.Position {
+	step := meters / metersPerDegree
+	pos.Lat = math.Max(-90, math.Min(90, math.Round(pos.Lat/step)*step))
+	lngStep := step / math.Max(math.Cos(pos.Lat*math.Pi/180), 0.01)
+	pos.Lng = math.Max(-180, math.Min(180, math.Round(pos.Lng/lngStep)*lngStep))
+
+	if pos.Accuracy == nil || *pos.Accuracy < meters {
+		pos.Accuracy = &meters
+	}
+	pos.Altitude, pos.Heading, pos.Speed = nil, nil, nil
+	return pos
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"log"
+	"time"
+)
+
+// Retention defaults, overridable via RETENTION_RAW, RETENTION_DOWNSAMPLED,
+// RETENTION_DOWNSAMPLE_BUCKET and RETENTION_INTERVAL.
+const (
+	DefaultRetentionRaw         = 30 * 24 * time.Hour  // full-resolution history and flagged fixes
+	DefaultRetentionDownsampled = 180 * 24 * time.Hour // thinned history, then deleted
+	DefaultDownsampleBucket     = 10 * time.Minute     // one fix per volunteer per bucket
+	DefaultRetentionInterval    = time.Hour
+)
+
+// RetentionService expires location data: history older than RawFor is
+// thinned to one fix per DownsampleBucket, and everything older than
+// DownsampledFor is deleted. Latest positions, flagged fixes, cleared
+// geofence alerts and the positions of resolved SOS incidents go once they
+// are older than RawFor.
+type RetentionService struct {
+	Repo             *repositories.RetentionRepository
+	RawFor           time.Duration
+	DownsampledFor   time.Duration // no downsampled stage if not longer than RawFor
+	DownsampleBucket time.Duration // 0 disables downsampling
+	Interval         time.Duration
+}
+
+// RetentionPolicy is the policy as reported to admins.
+type RetentionPolicy struct {
+	RawDays              float64 `json:"rawDays"`
+	DownsampledDays      float64 `json:"downsampledDays"`
+	DownsampleBucketSecs int     `json:"downsampleBucketSeconds"`
+	IntervalSecs         int     `json:"intervalSeconds"`
+}
+
+func (s *RetentionService) Policy() RetentionPolicy {
+	day := float64(24 * time.Hour)
+	return RetentionPolicy{
+		RawDays:              float64(s.RawFor) / day,
+		DownsampledDays:      float64(s.keepFor()) / day,
+		DownsampleBucketSecs: int(s.DownsampleBucket / time.Second),
+		IntervalSecs:         int(s.Interval / time.Second),
+	}
+}
+
+// keepFor is how long any history is kept at all.
+func (s *RetentionService) keepFor() time.Duration {
+	if s.DownsampledFor > s.RawFor {
+		return s.DownsampledFor
+	}
+	return s.RawFor
+}
+
+// Run enforces the policy every Interval until ctx is cancelled. Every
+// instance may run it; a Redis lock lets one pass through per interval.
+// A zero RawFor or Interval disables retention.
+func (s *RetentionService) Run(ctx context.Context) {
+	if s.RawFor <= 0 || s.Interval <= 0 {
+		log.Println("retention disabled")
+		return
+	}
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		ok, err := s.Repo.Lock(ctx, s.Interval)
+		if err != nil {
+			log.Println("retention lock error:", err)
+		} else if ok {
+			res, err := s.Enforce(ctx, time.Now().UTC())
+			if err != nil {
+				log.Println("retention error:", err)
+			}
+			log.Printf("retention: removed %d history, %d downsampled, %d latest, %d alerts, %d sos positions",
+				res.History, res.Downsampled, res.Latest, res.GeofenceAlerts, res.SOSPositions)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Enforce applies the policy as of now.
+func (s *RetentionService) Enforce(ctx context.Context, now time.Time) (repositories.PurgeResult, error) {
+	var res repositories.PurgeResult
+	rawCutoff := now.Add(-s.RawFor)
+	keepCutoff := now.Add(-s.keepFor())
+
+	var err error
+	if res.History, err = s.Repo.DeleteHistoryBefore(ctx, keepCutoff); err != nil {
+		return res, err
+	}
+	flagged, err := s.Repo.DeleteFlaggedBefore(ctx, rawCutoff)
+	res.History += flagged
+	if err != nil {
+		return res, err
+	}
+	if s.DownsampleBucket > 0 && keepCutoff.Before(rawCutoff) {
+		if res.Downsampled, err = s.Repo.Downsample(ctx, keepCutoff, rawCutoff, s.DownsampleBucket); err != nil {
+			return res, err
+		}
+	}
+	if res.Latest, err = s.Repo.DeleteLatestBefore(ctx, rawCutoff); err != nil {
+		return res, err
+	}
+	if res.GeofenceAlerts, err = s.Repo.DeleteClearedAlertsBefore(ctx, rawCutoff); err != nil {
+		return res, err
+	}
+	res.SOSPositions, err = s.Repo.ClearResolvedSOSBefore(ctx, rawCutoff)
+	return res, err
+}
+
+// PurgeVolunteer deletes all location data held for one volunteer, on request.
+func (s *RetentionService) PurgeVolunteer(ctx context.Context, volunteerID string) (repositories.PurgeResult, error) {
+	volunteerID, err := normalizeVolunteerID(volunteerID)
+	if err != nil {
+		return repositories.PurgeResult{}, err
+	}
+	return s.Repo.PurgeVolunteer(ctx, volunteerID)
+}
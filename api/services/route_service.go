@@ -0,0 +1,330 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// RouteEvent is the assignment channel message carrying a fresh plan.
+	RouteEvent = "route"
+	// WalkingSpeed turns route length into an estimated walking time, in m/s.
+	WalkingSpeed = 1.3
+	// MaxRouteStops bounds the stops a walk is optimised over. Beyond it the
+	// nearest are planned and the rest follow by distance; they are planned
+	// properly once earlier stops are done and the route is replanned.
+	MaxRouteStops = 500
+	// maxTwoOptPasses bounds 2-opt on very long stop lists.
+	maxTwoOptPasses = 50
+	// replanTimeout bounds a background replan.
+	replanTimeout = 30 * time.Second
+)
+
+// RouteService plans the order in which a volunteer walks their stops.
+type RouteService struct {
+	Assignments *repositories.AssignmentRepository
+	Volunteers  *repositories.VolunteerRepository
+
+	mu         sync.Mutex
+	replanning map[string]bool // volunteers with a replan running; true if another is due
+}
+
+type RoutePoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+type RouteStop struct {
+	Order int `json:"order"`
+	repositories.Assignment
+	LegMeters        float64 `json:"legMeters"`
+	CumulativeMeters float64 `json:"cumulativeMeters"`
+}
+
+// Route is an ordered walk over a volunteer's outstanding stops. Start is nil
+// when the volunteer's position is unknown, in which case the walk begins at
+// an outlying stop.
+type Route struct {
+	Type            string       `json:"type,omitempty"`
+	VolunteerID     string       `json:"volunteerId"`
+	Start           *RoutePoint  `json:"start"`
+	StartSource     string       `json:"startSource,omitempty"` // "live" or "last"
+	Stops           []RouteStop  `json:"stops"`
+	DistanceMeters  float64      `json:"distanceMeters"`
+	DurationSeconds float64      `json:"durationSeconds"`
+	GeoJSON         RouteFeature `json:"geojson"`
+	PlannedAt       time.Time    `json:"plannedAt"`
+}
+
+// RouteFeature is the route as a GeoJSON LineString feature; the geometry is
+// null when there are fewer than two points to join.
+type RouteFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *LineString            `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type LineString struct {
+	Type        string      `json:"type"`
+	Coordinates [][]float64 `json:"coordinates"`
+}
+
+// Plan orders a volunteer's outstanding stops into a short walk starting from
+// their live position, falling back to the last stored one.
+func (s *RouteService) Plan(ctx context.Context, volunteerID string) (Route, error) {
+	route := Route{VolunteerID: volunteerID, Stops: []RouteStop{}, PlannedAt: time.Now().UTC()}
+	stops, err := s.Assignments.ListPending(ctx, volunteerID)
+	if err != nil {
+		return route, err
+	}
+
+	if pos, err := s.Volunteers.GetLivePosition(ctx, volunteerID); err == nil {
+		route.Start, route.StartSource = &RoutePoint{Lat: pos.Lat, Lng: pos.Lng}, "live"
+	} else {
+		if !errors.Is(err, redis.Nil) {
+			log.Println("route live position error:", err)
+		}
+		if pos, err := s.Volunteers.GetLastPosition(ctx, volunteerID); err == nil {
+			route.Start, route.StartSource = &RoutePoint{Lat: pos.Lat, Lng: pos.Lng}, "last"
+		}
+	}
+
+	return layRoute(route, stops), nil
+}
+
+// layRoute orders stops into a walk from route.Start and fills in the legs,
+// totals and GeoJSON.
+func layRoute(route Route, stops []repositories.Assignment) Route {
+	points := make([]RoutePoint, 0, len(stops)+1)
+	if route.Start != nil {
+		points = append(points, *route.Start)
+	}
+	for _, st := range stops {
+		points = append(points, RoutePoint{Lat: st.Lat, Lng: st.Lng})
+	}
+	order := walkOrder(points, route.Start != nil)
+
+	coords := make([][]float64, 0, len(points))
+	var prev *RoutePoint
+	if route.Start != nil {
+		prev = route.Start
+		coords = append(coords, []float64{prev.Lng, prev.Lat})
+		order = order[1:]
+	}
+	for i, idx := range order {
+		p := points[idx]
+		if route.Start != nil {
+			idx-- // points[0] is the start, not a stop
+		}
+		leg := 0.0
+		if prev != nil {
+			leg = haversine(prev.Lat, prev.Lng, p.Lat, p.Lng)
+		}
+		route.DistanceMeters += leg
+		route.Stops = append(route.Stops, RouteStop{
+			Order:            i + 1,
+			Assignment:       stops[idx],
+			LegMeters:        leg,
+			CumulativeMeters: route.DistanceMeters,
+		})
+		coords = append(coords, []float64{p.Lng, p.Lat})
+		prev = &p
+	}
+	route.DurationSeconds = route.DistanceMeters / WalkingSpeed
+
+	stopIDs := make([]int, 0, len(route.Stops))
+	for _, st := range route.Stops {
+		stopIDs = append(stopIDs, st.StopID)
+	}
+	route.GeoJSON = RouteFeature{
+		Type: "Feature",
+		Properties: map[string]interface{}{
+			"volunteerId":    route.VolunteerID,
+			"stopIds":        stopIDs,
+			"distanceMeters": route.DistanceMeters,
+		},
+	}
+	if len(coords) >= 2 {
+		route.GeoJSON.Geometry = &LineString{Type: "LineString", Coordinates: coords}
+	}
+	return route
+}
+
+// VolunteerRoute plans the route for a volunteer ID given by an admin.
+func (s *RouteService) VolunteerRoute(ctx context.Context, volunteerID string) (Route, error) {
+	volunteerID, err := normalizeVolunteerID(volunteerID)
+	if err != nil {
+		return Route{}, err
+	}
+	return s.Plan(ctx, volunteerID)
+}
+
+// Replan pushes a fresh route to the volunteer's live connections after
+// their stops change. Like assignment events it is best effort. Planning runs
+// in the background so it never holds up the request that changed the stops;
+// changes arriving while a plan runs are folded into one more plan.
+func (s *RouteService) Replan(volunteerID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.replanning == nil {
+		s.replanning = make(map[string]bool)
+	}
+	if _, running := s.replanning[volunteerID]; running {
+		s.replanning[volunteerID] = true
+		return
+	}
+	s.replanning[volunteerID] = false
+	go func() {
+		for {
+			s.replan(volunteerID)
+			s.mu.Lock()
+			if !s.replanning[volunteerID] {
+				delete(s.replanning, volunteerID)
+				s.mu.Unlock()
+				return
+			}
+			s.replanning[volunteerID] = false
+			s.mu.Unlock()
+		}
+	}()
+}
+
+func (s *RouteService) replan(volunteerID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), replanTimeout)
+	defer cancel()
+	route, err := s.Plan(ctx, volunteerID)
+	if err != nil {
+		log.Println("route plan error:", err)
+		return
+	}
+	route.Type = RouteEvent
+	if err := s.Assignments.Publish(ctx, volunteerID, route); err != nil {
+		log.Println("route publish error:", err)
+	}
+}
+
+// walkOrder returns an open path visiting every point, as indexes into
+// points. With fixedStart the path begins at points[0]; otherwise it begins
+// at the point farthest from the centroid, which tends to sweep rather than
+// double back. Only the MaxRouteStops points nearest the start are optimised;
+// the rest follow, nearest first.
+func walkOrder(points []RoutePoint, fixedStart bool) []int {
+	n := len(points)
+	if n <= MaxRouteStops {
+		return shortWalk(points, fixedStart)
+	}
+	first := 0
+	if !fixedStart {
+		first = outlier(points)
+	}
+	a := points[first]
+	dist := make([]float64, n)
+	rest := make([]int, 0, n-1)
+	for i, p := range points {
+		if i != first {
+			dist[i] = haversine(a.Lat, a.Lng, p.Lat, p.Lng)
+			rest = append(rest, i)
+		}
+	}
+	sort.SliceStable(rest, func(i, j int) bool { return dist[rest[i]] < dist[rest[j]] })
+
+	near := append([]int{first}, rest[:MaxRouteStops-1]...)
+	sub := make([]RoutePoint, len(near))
+	for i, idx := range near {
+		sub[i] = points[idx]
+	}
+	order := make([]int, 0, n)
+	for _, i := range shortWalk(sub, true) {
+		order = append(order, near[i])
+	}
+	return append(order, rest[MaxRouteStops-1:]...)
+}
+
+// outlier returns the point farthest from the centroid.
+func outlier(points []RoutePoint) int {
+	c := centroid(points, nil)
+	first, far := 0, -1.0
+	for i, p := range points {
+		if d := haversine(c.Lat, c.Lng, p.Lat, p.Lng); d > far {
+			first, far = i, d
+		}
+	}
+	return first
+}
+
+// shortWalk is walkOrder without the cap: the path is built nearest-neighbor
+// first and then improved by 2-opt on haversine distances.
+func shortWalk(points []RoutePoint, fixedStart bool) []int {
+	n := len(points)
+	if n == 0 {
+		return nil
+	}
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+		for j := 0; j < i; j++ {
+			d := haversine(points[i].Lat, points[i].Lng, points[j].Lat, points[j].Lng)
+			dist[i][j], dist[j][i] = d, d
+		}
+	}
+
+	first := 0
+	if !fixedStart {
+		first = outlier(points)
+	}
+
+	// Nearest neighbor
+	order := make([]int, 0, n)
+	visited := make([]bool, n)
+	curr := first
+	for {
+		order = append(order, curr)
+		visited[curr] = true
+		next, best := -1, math.Inf(1)
+		for j := 0; j < n; j++ {
+			if !visited[j] && dist[curr][j] < best {
+				next, best = j, dist[curr][j]
+			}
+		}
+		if next < 0 {
+			break
+		}
+		curr = next
+	}
+
+	// 2-opt: reverse order[i..k] whenever that shortens the path. The first
+	// point stays put and the end is open, so a reversal reaching the end
+	// only changes the edge into order[i].
+	const eps = 1e-6
+	for pass := 0; pass < maxTwoOptPasses; pass++ {
+		improved := false
+		for i := 1; i < n-1; i++ {
+			for k := i + 1; k < n; k++ {
+				a, b, c := order[i-1], order[i], order[k]
+				delta := dist[a][c] - dist[a][b]
+				if k+1 < n {
+					d := order[k+1]
+					delta += dist[b][d] - dist[c][d]
+				}
+				if delta < -eps {
+					for l, r := i, k; l < r; l, r = l+1, r-1 {
+						order[l], order[r] = order[r], order[l]
+					}
+					improved = true
+				}
+			}
+		}
+		if !improved {
+			break
+		}
+	}
+	return order
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestLayRoute(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+	assignments := func(n int) []repositories.Assignment {
+		stops := make([]repositories.Assignment, n)
+		for i, p := range blob(rng, n, 40.70, -73.95, 3000) {
+			stops[i] = repositories.Assignment{StopID: i + 1, Lat: p.Lat, Lng: p.Lng}
+		}
+		return stops
+	}
+	start := &RoutePoint{Lat: 40.70, Lng: -73.95}
+
+	tests := []struct {
+		name  string
+		start *RoutePoint
+		stops []repositories.Assignment
+	}{
+		{"no stops", start, nil},
+		{"no start", nil, assignments(20)},
+		{"from the volunteer", start, assignments(20)},
+		{"at the cap", start, assignments(MaxRouteStops)},
+		{"whole area", start, assignments(MaxTurfStops)},
+		{"whole area without a start", nil, assignments(MaxTurfStops)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			began := time.Now()
+			route := layRoute(Route{VolunteerID: "v1", Start: tt.start, Stops: []RouteStop{}}, tt.stops)
+			if took := time.Since(began); took > 5*time.Second {
+				t.Errorf("planning %d stops took %v", len(tt.stops), took)
+			}
+
+			if len(route.Stops) != len(tt.stops) {
+				t.Fatalf("route has %d stops, want %d", len(route.Stops), len(tt.stops))
+			}
+			seen := make(map[int]bool, len(tt.stops))
+			cum := 0.0
+			for i, st := range route.Stops {
+				if st.Order != i+1 {
+					t.Fatalf("stop %d has order %d", i, st.Order)
+				}
+				if seen[st.StopID] {
+					t.Fatalf("stop %d visited twice", st.StopID)
+				}
+				seen[st.StopID] = true
+				if cum += st.LegMeters; st.CumulativeMeters != cum {
+					t.Fatalf("stop %d: cumulative %g, want %g", i, st.CumulativeMeters, cum)
+				}
+			}
+			if route.DistanceMeters != cum {
+				t.Errorf("distance %g, want %g", route.DistanceMeters, cum)
+			}
+			points := len(tt.stops)
+			if tt.start != nil {
+				points++
+			}
+			if (route.GeoJSON.Geometry != nil) != (points >= 2) {
+				t.Errorf("geometry %v for %d points", route.GeoJSON.Geometry, points)
+			} else if points >= 2 && len(route.GeoJSON.Geometry.Coordinates) != points {
+				t.Errorf("line has %d coordinates, want %d", len(route.GeoJSON.Geometry.Coordinates), points)
+			}
+		})
+	}
+}
+
+func TestWalkOrderCapped(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	points := blob(rng, 3*MaxRouteStops, 51.5, -0.12, 2000)
+
+	for _, fixedStart := range []bool{true, false} {
+		order := walkOrder(points, fixedStart)
+		if len(order) != len(points) {
+			t.Fatalf("order has %d points, want %d", len(order), len(points))
+		}
+		seen := make([]bool, len(points))
+		for _, i := range order {
+			if seen[i] {
+				t.Fatalf("point %d visited twice", i)
+			}
+			seen[i] = true
+		}
+		first := 0
+		if !fixedStart {
+			first = outlier(points)
+		}
+		if order[0] != first {
+			t.Errorf("fixedStart %v: walk starts at %d, want %d", fixedStart, order[0], first)
+		}
+
+		// The unplanned tail follows nearest first from the start.
+		a := points[first]
+		for i := MaxRouteStops + 1; i < len(order); i++ {
+			p, q := points[order[i-1]], points[order[i]]
+			if haversine(a.Lat, a.Lng, p.Lat, p.Lng) > haversine(a.Lat, a.Lng, q.Lat, q.Lng) {
+				t.Fatalf("tail is not in distance order at %d", i)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Position threshold defaults, overridable via POSITION_MIN_DISTANCE_METERS,
+// POSITION_MIN_UPDATE_INTERVAL and POSITION_LIVE_TTL, then at runtime through
+// the settings API.
+const (
+	DefaultMinDistanceMeters = 50.0             // Only persist if volunteer moved >50m
+	DefaultMinUpdateInterval = 5 * time.Minute  // Or if last update >5 minutes ago
+	DefaultLiveTTL           = 10 * time.Minute // How long a live position stays on the map
+	SettingsRefreshInterval  = 30 * time.Second // How often other instances pick up changes
+)
+
+// PositionThresholds are the resolved settings applied to one fix.
+type PositionThresholds struct {
+	MinDistanceMeters float64       `json:"minDistanceMeters"`
+	MinUpdateInterval time.Duration `json:"-"`
+	LiveTTL           time.Duration `json:"-"`
+}
+
+// areaSettings is an area override with its polygon parsed for lookups.
+type areaSettings struct {
+	rings      [][][]float64
+	thresholds PositionThresholds
+}
+
+// SettingsService holds the position thresholds in memory so resolving them
+// costs nothing per fix. Changes made through this instance apply at once;
+// Run reloads periodically so other instances follow.
+type SettingsService struct {
+	Repo     *repositories.SettingsRepository
+	Areas    *repositories.AreaRepository
+	Defaults PositionThresholds // from env; the base every override inherits from
+
+	mu     sync.RWMutex
+	global PositionThresholds
+	areas  []areaSettings
+	rows   []repositories.PositionSettings
+	loaded bool
+}
+
+// Run keeps the cache fresh until ctx is cancelled.
+func (s *SettingsService) Run(ctx context.Context) {
+	ticker := time.NewTicker(SettingsRefreshInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.Load(ctx); err != nil {
+			log.Println("position settings load error:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Load replaces the cache with the overrides stored in Postgres.
+func (s *SettingsService) Load(ctx context.Context) error {
+	rows, err := s.Repo.ListPositionSettings(ctx)
+	if err != nil {
+		return err
+	}
+
+	global := s.Defaults
+	var areas []areaSettings
+	for _, row := range rows {
+		if row.AreaID == nil {
+			global = applySettings(global, row)
+			continue
+		}
+		_, rings, err := normalizePolygon(row.Polygon)
+		if err != nil {
+			log.Printf("position settings: skipping area %d: %v", *row.AreaID, err)
+			continue
+		}
+		areas = append(areas, areaSettings{rings: rings, thresholds: applySettings(global, row)})
+	}
+
+	s.mu.Lock()
+	s.global, s.areas, s.rows, s.loaded = global, areas, rows, true
+	s.mu.Unlock()
+	return nil
+}
+
+// applySettings overlays the non-nil fields of row onto base.
+func applySettings(base PositionThresholds, row repositories.PositionSettings) PositionThresholds {
+	if row.MinDistanceMeters != nil {
+		base.MinDistanceMeters = *row.MinDistanceMeters
+	}
+	if row.MinUpdateIntervalSeconds != nil {
+		base.MinUpdateInterval = time.Duration(*row.MinUpdateIntervalSeconds) * time.Second
+	}
+	if row.LiveTTLSeconds != nil {
+		base.LiveTTL = time.Duration(*row.LiveTTLSeconds) * time.Second
+	}
+	return base
+}
+
+// For returns the thresholds in effect at a point: the smallest area with an
+// override that contains it, else the global settings.
+func (s *SettingsService) For(lat, lng float64) PositionThresholds {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if !s.loaded {
+		return s.Defaults
+	}
+	for _, a := range s.areas {
+		if pointInPolygon(lng, lat, a.rings) {
+			return a.thresholds
+		}
+	}
+	return s.global
+}
+
+// PositionSettingsView is what the admin API shows: the env defaults, the
+// resolved global settings and every stored override.
+type PositionSettingsView struct {
+	Defaults  ThresholdsView                  `json:"defaults"`
+	Effective ThresholdsView                  `json:"effective"`
+	Overrides []repositories.PositionSettings `json:"overrides"`
+}
+
+// ThresholdsView renders PositionThresholds with durations in seconds.
+type ThresholdsView struct {
+	MinDistanceMeters        float64 `json:"minDistanceMeters"`
+	MinUpdateIntervalSeconds int     `json:"minUpdateIntervalSeconds"`
+	LiveTTLSeconds           int     `json:"liveTtlSeconds"`
+}
+
+func viewThresholds(t PositionThresholds) ThresholdsView {
+	return ThresholdsView{
+		MinDistanceMeters:        t.MinDistanceMeters,
+		MinUpdateIntervalSeconds: int(t.MinUpdateInterval / time.Second),
+		LiveTTLSeconds:           int(t.LiveTTL / time.Second),
+	}
+}
+
+func (s *SettingsService) Get(ctx context.Context) (PositionSettingsView, error) {
+	if err := s.Load(ctx); err != nil {
+		return PositionSettingsView{}, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	overrides := s.rows
+	if overrides == nil {
+		overrides = []repositories.PositionSettings{}
+	}
+	return PositionSettingsView{
+		Defaults:  viewThresholds(s.Defaults),
+		Effective: viewThresholds(s.global),
+		Overrides: overrides,
+	}, nil
+}
+
+// Update stores an override globally (areaID nil) or for one area and
+// applies it on this instance immediately.
+func (s *SettingsService) Update(ctx context.Context, areaID *int, in repositories.PositionSettings) error {
+	if in.MinDistanceMeters != nil && *in.MinDistanceMeters < 0 {
+		return invalidf("minDistanceMeters may not be negative")
+	}
+	if in.MinUpdateIntervalSeconds != nil && *in.MinUpdateIntervalSeconds < 0 {
+		return invalidf("minUpdateIntervalSeconds may not be negative")
+	}
+	if in.LiveTTLSeconds != nil && *in.LiveTTLSeconds < 60 {
+		return invalidf("liveTtlSeconds must be at least 60")
+	}
+	if areaID != nil {
+		if _, err := s.Areas.GetArea(ctx, *areaID); err != nil {
+			return err
+		}
+	}
+
+	in.AreaID = areaID
+	if err := s.Repo.UpsertPositionSettings(ctx, in); err != nil {
+		return err
+	}
+	return s.Load(ctx)
+}
+
+// Reset removes an override so the level above applies again.
+func (s *SettingsService) Reset(ctx context.Context, areaID *int) error {
+	if err := s.Repo.DeletePositionSettings(ctx, areaID); err != nil {
+		return err
+	}
+	return s.Load(ctx)
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"log"
+	"time"
+)
+
+// ShiftService runs check-in and check-out. Positions are only accepted
+// while a volunteer has an open shift (see VolunteerService.UpdatePosition),
+// and each closed shift records the distance walked and doors knocked.
+type ShiftService struct {
+	Repo       *repositories.ShiftRepository
+	Areas      *repositories.AreaRepository
+	Volunteers *repositories.VolunteerRepository
+	Canvass    *repositories.CanvassRepository
+}
+
+// CheckIn opens a shift, optionally tied to an area.
+func (s *ShiftService) CheckIn(ctx context.Context, volunteerID, fullName string, areaID *int) (repositories.Shift, error) {
+	if areaID != nil {
+		if _, err := s.Areas.GetArea(ctx, *areaID); err != nil {
+			return repositories.Shift{}, err
+		}
+	}
+	return s.Repo.OpenShift(ctx, volunteerID, fullName, areaID)
+}
+
+// CheckOut closes the open shift, totals it and takes the volunteer off the
+// live map.
+func (s *ShiftService) CheckOut(ctx context.Context, volunteerID string) (repositories.Shift, error) {
+	shift, err := s.Repo.GetOpenShift(ctx, volunteerID)
+	if err != nil {
+		return shift, err
+	}
+
+	end := time.Now().UTC()
+	points, err := s.Volunteers.GetTrack(ctx, volunteerID, shift.StartedAt, end)
+	if err != nil {
+		return shift, err
+	}
+	doors, err := s.Canvass.CountResults(ctx, volunteerID, shift.StartedAt, end)
+	if err != nil {
+		return shift, err
+	}
+
+	closed, err := s.Repo.CloseShift(ctx, shift.ID, end, trackDistance(points), doors)
+	if err != nil {
+		return closed, err
+	}
+	if err := s.Volunteers.DeleteLivePosition(ctx, volunteerID); err != nil {
+		log.Println("clear live position error:", err)
+	}
+	return closed, nil
+}
+
+// trackDistance sums the haversine distance along a track.
+func trackDistance(points []repositories.TrackPoint) float64 {
+	var d float64
+	for i := 1; i < len(points); i++ {
+		d += haversine(points[i-1].Lat, points[i-1].Lng, points[i].Lat, points[i].Lng)
+	}
+	return d
+}
+
+// Current returns the volunteer's open shift, or ErrNoOpenShift.
+func (s *ShiftService) Current(ctx context.Context, volunteerID string) (repositories.Shift, error) {
+	return s.Repo.GetOpenShift(ctx, volunteerID)
+}
+
+// RequireOpen returns ErrNoOpenShift unless the volunteer is checked in.
+func (s *ShiftService) RequireOpen(ctx context.Context, volunteerID string) error {
+	open, err := s.Repo.HasOpenShift(ctx, volunteerID)
+	if err != nil {
+		return err
+	}
+	if !open {
+		return repositories.ErrNoOpenShift
+	}
+	return nil
+}
+
+// During returns the volunteer's shifts overlapping a time window, for
+// filtering fixes uploaded after the fact.
+func (s *ShiftService) During(ctx context.Context, volunteerID string, from, to time.Time) ([]repositories.Shift, error) {
+	return s.Repo.ListShifts(ctx, volunteerID, from, to)
+}
+
+// onShift reports whether t falls within one of shifts; open shifts run until now.
+func onShift(shifts []repositories.Shift, t time.Time) bool {
+	for _, sh := range shifts {
+		if t.Before(sh.StartedAt) {
+			continue
+		}
+		if sh.EndedAt == nil || !t.After(*sh.EndedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns shifts overlapping a window; volunteerID is optional.
+func (s *ShiftService) List(ctx context.Context, volunteerID string, from, to time.Time) ([]repositories.Shift, error) {
+	if volunteerID != "" {
+		id, err := normalizeVolunteerID(volunteerID)
+		if err != nil {
+			return nil, err
+		}
+		volunteerID = id
+	}
+	if !from.Before(to) {
+		return nil, invalidf("from must be before to")
+	}
+	return s.Repo.ListShifts(ctx, volunteerID, from, to)
+}
+
+// Totals sums hours, distance and doors per volunteer over closed shifts.
+func (s *ShiftService) Totals(ctx context.Context, from, to time.Time) ([]repositories.ShiftTotals, error) {
+	if !from.Before(to) {
+		return nil, invalidf("from must be before to")
+	}
+	return s.Repo.Totals(ctx, from, to)
+}
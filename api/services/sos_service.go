@@ -0,0 +1,173 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// SOS defaults, overridable via SOS_REMINDER_INTERVAL.
+const (
+	DefaultSOSReminderInterval = time.Minute
+	sosReminderCheck           = 10 * time.Second
+	MaxSOSMessageLength        = 1000
+	MaxSOSNoteLength           = 4000
+)
+
+// SOSService handles volunteer emergencies: raising an incident, pushing it
+// to every admin stream regardless of their filters, re-broadcasting it until
+// someone acknowledges it, and recording how it was handled.
+type SOSService struct {
+	Repo             *repositories.SOSRepository
+	Volunteers       *repositories.VolunteerRepository
+	ReminderInterval time.Duration
+}
+
+// SOSRequest is what a volunteer sends; every field is optional.
+type SOSRequest struct {
+	Lat      *float64 `json:"lat"`
+	Lng      *float64 `json:"lng"`
+	Accuracy *float64 `json:"accuracy"`
+	Message  string   `json:"message"`
+}
+
+// Raise records an emergency. Privacy settings and shifts deliberately do not
+// apply: the position is taken from the request, else the live map, else the
+// last stored fix, and the incident is raised even if none is known.
+func (s *SOSService) Raise(ctx context.Context, volunteerID, fullName string, req SOSRequest) (repositories.Incident, error) {
+	in := repositories.Incident{
+		VolunteerID: volunteerID,
+		FullName:    fullName,
+		Accuracy:    req.Accuracy,
+		Message:     strings.TrimSpace(req.Message),
+	}
+	if len(in.Message) > MaxSOSMessageLength {
+		return in, invalidf("message may not exceed %d characters", MaxSOSMessageLength)
+	}
+
+	if req.Lat != nil && req.Lng != nil {
+		pos := repositories.Position{Lat: *req.Lat, Lng: *req.Lng, Accuracy: req.Accuracy}
+		if err := validatePosition(pos); err != nil {
+			return in, err
+		}
+		in.Lat, in.Lng = req.Lat, req.Lng
+	} else if pos, err := s.knownPosition(ctx, volunteerID); err == nil {
+		in.Lat, in.Lng, in.Accuracy = &pos.Lat, &pos.Lng, pos.Accuracy
+	} else {
+		log.Println("sos: no position for", volunteerID, err)
+	}
+
+	saved, err := s.Repo.Raise(ctx, in)
+	if err != nil {
+		return saved, err
+	}
+	saved.Type = repositories.SOSRaised
+	if err := s.Repo.Publish(ctx, saved); err != nil {
+		// The incident is stored and the reminder loop will retry the broadcast.
+		log.Println("sos publish error:", err)
+	}
+	return saved, nil
+}
+
+// knownPosition falls back from the live map to the last stored fix.
+func (s *SOSService) knownPosition(ctx context.Context, volunteerID string) (repositories.Position, error) {
+	pos, err := s.Volunteers.GetLivePosition(ctx, volunteerID)
+	if err == nil {
+		return pos, nil
+	}
+	if !errors.Is(err, redis.Nil) {
+		log.Println("sos live position error:", err)
+	}
+	return s.Volunteers.GetLastPosition(ctx, volunteerID)
+}
+
+// Acknowledge marks an open incident as being handled, with an optional note.
+func (s *SOSService) Acknowledge(ctx context.Context, id int, adminID, adminName, note string) (repositories.Incident, error) {
+	return s.transition(ctx, id, repositories.IncidentAcknowledged, repositories.SOSAcknowledged, adminID, adminName, note)
+}
+
+// Resolve closes an incident, with an optional note.
+func (s *SOSService) Resolve(ctx context.Context, id int, adminID, adminName, note string) (repositories.Incident, error) {
+	return s.transition(ctx, id, repositories.IncidentResolved, repositories.SOSResolved, adminID, adminName, note)
+}
+
+func (s *SOSService) transition(ctx context.Context, id int, to, event, adminID, adminName, note string) (repositories.Incident, error) {
+	note = strings.TrimSpace(note)
+	if len(note) > MaxSOSNoteLength {
+		return repositories.Incident{}, invalidf("note may not exceed %d characters", MaxSOSNoteLength)
+	}
+	in, err := s.Repo.Transition(ctx, id, to, adminID)
+	if err != nil {
+		return in, err
+	}
+	if note != "" {
+		if _, err := s.AddNote(ctx, id, adminID, adminName, note); err != nil {
+			return in, err
+		}
+	}
+	in.Type = event
+	if err := s.Repo.Publish(ctx, in); err != nil {
+		log.Println("sos publish error:", err)
+	}
+	return s.Repo.Get(ctx, id)
+}
+
+func (s *SOSService) AddNote(ctx context.Context, id int, authorID, authorName, body string) (repositories.IncidentNote, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return repositories.IncidentNote{}, invalidf("note is required")
+	}
+	if len(body) > MaxSOSNoteLength {
+		return repositories.IncidentNote{}, invalidf("note may not exceed %d characters", MaxSOSNoteLength)
+	}
+	return s.Repo.AddNote(ctx, repositories.IncidentNote{
+		IncidentID: id,
+		AuthorID:   authorID,
+		AuthorName: authorName,
+		Body:       body,
+	})
+}
+
+func (s *SOSService) Get(ctx context.Context, id int) (repositories.Incident, error) {
+	return s.Repo.Get(ctx, id)
+}
+
+// List returns incidents in a status, or every unresolved one if status is empty.
+func (s *SOSService) List(ctx context.Context, status string) ([]repositories.Incident, error) {
+	switch status {
+	case "", repositories.IncidentOpen, repositories.IncidentAcknowledged, repositories.IncidentResolved:
+	default:
+		return nil, invalidf("unknown status %q", status)
+	}
+	return s.Repo.List(ctx, status, 500)
+}
+
+// Run re-broadcasts unacknowledged incidents every ReminderInterval until ctx
+// is cancelled. Every instance may run it; each reminder is claimed once.
+func (s *SOSService) Run(ctx context.Context) {
+	ticker := time.NewTicker(sosReminderCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			due, err := s.Repo.ClaimReminders(ctx, s.ReminderInterval)
+			if err != nil {
+				log.Println("sos reminder error:", err)
+				continue
+			}
+			for _, in := range due {
+				in.Type = repositories.SOSReminder
+				if err := s.Repo.Publish(ctx, in); err != nil {
+					log.Println("sos publish error:", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"math"
+	"strings"
+)
+
+const (
+	MaxStopSearchRadius = 50000.0 // meters; keeps a typo from scanning a whole metro area
+	MaxBulkStops        = 5000    // per bulk-create request
+)
+
+type StopService struct {
+	Repo  *repositories.StopRepository
+	Areas *repositories.AreaRepository
+}
+
+// StopRequest is a stop as posted by an admin; lat and lng are required.
+type StopRequest struct {
+	Name string   `json:"name"`
+	Lat  *float64 `json:"lat"`
+	Lng  *float64 `json:"lng"`
+}
+
+func (r StopRequest) stop(i int) (repositories.Stop, error) {
+	if r.Lat == nil || r.Lng == nil {
+		return repositories.Stop{}, invalidf("stop %d is missing lat or lng", i)
+	}
+	stop := repositories.Stop{Name: r.Name, Lat: *r.Lat, Lng: *r.Lng}
+	return stop, validateStop(i, stop)
+}
+
+func validateStop(i int, s repositories.Stop) error {
+	if math.IsNaN(s.Lat) || math.IsNaN(s.Lng) || s.Lat < -90 || s.Lat > 90 || s.Lng < -180 || s.Lng > 180 {
+		return invalidf("stop %d has out-of-range coordinates: lat %g, lng %g", i, s.Lat, s.Lng)
+	}
+	if math.Abs(s.Lat) < nullIslandDegrees && math.Abs(s.Lng) < nullIslandDegrees {
+		return invalidf("stop %d is at 0,0", i)
+	}
+	return nil
+}
+
+func (s *StopService) CreateStop(ctx context.Context, areaID int, req StopRequest) (repositories.Stop, error) {
+	stop, err := req.stop(0)
+	if err != nil {
+		return repositories.Stop{}, err
+	}
+	return s.createStop(ctx, areaID, stop)
+}
+
+// createStop stores a stop that has already been validated.
+func (s *StopService) createStop(ctx context.Context, areaID int, stop repositories.Stop) (repositories.Stop, error) {
+	stop.AreaID = areaID
+	stop.Name = strings.TrimSpace(stop.Name)
+	return s.Repo.CreateStop(ctx, stop)
+}
+
+func (s *StopService) CreateStops(ctx context.Context, areaID int, reqs []StopRequest) ([]repositories.Stop, error) {
+	if len(reqs) == 0 {
+		return nil, invalidf("no stops supplied")
+	}
+	if len(reqs) > MaxBulkStops {
+		return nil, invalidf("too many stops: %d (max %d)", len(reqs), MaxBulkStops)
+	}
+	stops := make([]repositories.Stop, len(reqs))
+	for i, req := range reqs {
+		stop, err := req.stop(i)
+		if err != nil {
+			return nil, err
+		}
+		stop.AreaID = areaID
+		stop.Name = strings.TrimSpace(stop.Name)
+		stops[i] = stop
+	}
+	return s.Repo.CreateStops(ctx, stops)
+}
+
+func (s *StopService) ListStops(ctx context.Context, areaID int) ([]repositories.Stop, error) {
+	if _, err := s.Areas.GetArea(ctx, areaID); err != nil {
+		return nil, err
+	}
+	return s.Repo.ListStops(ctx, areaID)
+}
+
+func (s *StopService) StopsNear(ctx context.Context, areaID int, lat, lng, radius float64) ([]repositories.Stop, error) {
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil, invalidf("point is out of range: lat %g, lng %g", lat, lng)
+	}
+	if radius <= 0 || radius > MaxStopSearchRadius {
+		return nil, invalidf("radius must be between 0 and %g meters", MaxStopSearchRadius)
+	}
+	if _, err := s.Areas.GetArea(ctx, areaID); err != nil {
+		return nil, err
+	}
+	return s.Repo.StopsWithin(ctx, areaID, lat, lng, radius)
+}
+
+func (s *StopService) StopsInBBox(ctx context.Context, areaID int, minLng, minLat, maxLng, maxLat float64) ([]repositories.Stop, error) {
+	if minLng > maxLng || minLat > maxLat {
+		return nil, invalidf("bbox must be minLng,minLat,maxLng,maxLat")
+	}
+	if minLat < -90 || maxLat > 90 || minLng < -180 || maxLng > 180 {
+		return nil, invalidf("bbox is out of range")
+	}
+	if _, err := s.Areas.GetArea(ctx, areaID); err != nil {
+		return nil, err
+	}
+	return s.Repo.StopsInBBox(ctx, areaID, minLng, minLat, maxLng, maxLat)
+}
+
+func (s *StopService) DeleteStop(ctx context.Context, areaID, stopID int) error {
+	return s.Repo.DeleteStop(ctx, areaID, stopID)
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestStopRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lng *float64
+		valid    bool
+	}{
+		{"valid", ptr(40.7), ptr(-74), true},
+		{"on the equator", ptr(0), ptr(32.5), true},
+		{"on the meridian", ptr(51.48), ptr(0), true},
+		{"missing lat", nil, ptr(-74), false},
+		{"missing lng", ptr(40.7), nil, false},
+		{"missing both", nil, nil, false},
+		{"null island", ptr(0), ptr(0), false},
+		{"lat out of range", ptr(90.5), ptr(-74), false},
+		{"lng out of range", ptr(40.7), ptr(180.5), false},
+		{"NaN", ptr(math.NaN()), ptr(-74), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stop, err := StopRequest{Name: "12 Main St", Lat: tt.lat, Lng: tt.lng}.stop(3)
+			if (err == nil) != tt.valid {
+				t.Fatalf("stop() error = %v, want valid %v", err, tt.valid)
+			}
+			if err == nil && (stop.Lat != *tt.lat || stop.Lng != *tt.lng || stop.Name != "12 Main St") {
+				t.Errorf("stop() = %+v", stop)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	streamHubWait   = 5 * time.Second
+	maxPendingEvent = 1000 // events buffered for a client still catching up
+)
+
+// Subscription is one stream client's registration with the hub. Live events
+// are held back until the client has received its snapshot or replay, then
+// handed to Deliver in order, skipping any the catch-up already covered.
+type Subscription struct {
+	filter  atomic.Pointer[StreamFilter]
+	deliver func(ev repositories.StreamEvent, catchingUp bool) bool
+
+	catchingUp sync.Mutex // one snapshot or replay at a time
+
+	mu       sync.Mutex
+	active   bool
+	after    int64
+	pending  []repositories.StreamEvent
+	overflow bool
+	closed   bool
+}
+
+// hold replaces the filter and holds live events back until the next activate.
+func (sub *Subscription) hold(f *StreamFilter) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	sub.filter.Store(f)
+	sub.active, sub.pending, sub.overflow = false, nil, false
+}
+
+// offer hands a live event to the subscription and reports whether it is still open.
+func (sub *Subscription) offer(ev repositories.StreamEvent) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.closed {
+		return false
+	}
+	if !sub.active {
+		if len(sub.pending) >= maxPendingEvent {
+			sub.overflow = true
+			return true
+		}
+		sub.pending = append(sub.pending, ev)
+		return true
+	}
+	return sub.send(ev)
+}
+
+// send must be called with sub.mu held.
+func (sub *Subscription) send(ev repositories.StreamEvent) bool {
+	if ev.Seq <= sub.after {
+		return true
+	}
+	sub.after = ev.Seq
+	if !sub.filter.Load().MatchesEvent(ev) {
+		return true
+	}
+	if !sub.deliver(ev, false) {
+		sub.closed = true
+		return false
+	}
+	return true
+}
+
+// activate flushes events held during catch-up that are newer than cursor.
+func (sub *Subscription) activate(cursor int64) bool {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if sub.overflow {
+		sub.closed = true
+		return false
+	}
+	sub.active, sub.after = true, cursor
+	for _, ev := range sub.pending {
+		if !sub.send(ev) {
+			return false
+		}
+	}
+	sub.pending = nil
+	return true
+}
+
+// NewSubscription prepares a stream client with an initial filter (nil
+// matches everything). deliver may block while catchingUp but must not block
+// for live events; returning false ends the subscription.
+func NewSubscription(f *StreamFilter, deliver func(ev repositories.StreamEvent, catchingUp bool) bool) *Subscription {
+	sub := &Subscription{deliver: deliver}
+	sub.filter.Store(f)
+	return sub
+}
+
+// Subscribe registers a stream client with the hub. The client first receives
+// either the events after since (when hasSince and they are still held) or a
+// snapshot, then every matching live event until Unsubscribe.
+func (s *StreamService) Subscribe(ctx context.Context, sub *Subscription, since int64, hasSince bool) error {
+	// Register before catching up so nothing published meanwhile is missed.
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[*Subscription]struct{})
+	}
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	s.Metrics.clientJoined()
+
+	sub.catchingUp.Lock()
+	defer sub.catchingUp.Unlock()
+	cursor, err := s.catchUp(ctx, sub, since, hasSince)
+	if err != nil {
+		s.Unsubscribe(sub)
+		return err
+	}
+	if !sub.activate(cursor) {
+		s.Unsubscribe(sub)
+		return errSlowSubscriber
+	}
+	return nil
+}
+
+var errSlowSubscriber = errors.New("client fell behind while catching up")
+
+// Refilter switches a subscription to a new filter and sends a snapshot
+// matching it. Live events are held while the snapshot is taken and those it
+// already covers are dropped, so no event queued ahead of the snapshot can be
+// overwritten by an older row.
+func (s *StreamService) Refilter(ctx context.Context, sub *Subscription, f *StreamFilter) error {
+	sub.catchingUp.Lock()
+	defer sub.catchingUp.Unlock()
+	sub.hold(f)
+	snap, err := s.Snapshot(ctx, f)
+	if err != nil {
+		return err
+	}
+	if !sub.deliver(snap, true) || !sub.activate(snap.Seq) {
+		return errSlowSubscriber
+	}
+	return nil
+}
+
+func (s *StreamService) catchUp(ctx context.Context, sub *Subscription, since int64, hasSince bool) (int64, error) {
+	if hasSince {
+		events, ok, err := s.Resume(ctx, since)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			cursor := since
+			for _, ev := range events {
+				cursor = ev.Seq
+				if sub.filter.Load().MatchesEvent(ev) && !sub.deliver(ev, true) {
+					return 0, errSlowSubscriber
+				}
+			}
+			return cursor, nil
+		}
+	}
+
+	snap, err := s.Snapshot(ctx, sub.filter.Load())
+	if err != nil {
+		return 0, err
+	}
+	if !sub.deliver(snap, true) {
+		return 0, errSlowSubscriber
+	}
+	return snap.Seq, nil
+}
+
+func (s *StreamService) Unsubscribe(sub *Subscription) {
+	sub.mu.Lock()
+	sub.closed = true
+	sub.mu.Unlock()
+
+	s.mu.Lock()
+	_, ok := s.subs[sub]
+	delete(s.subs, sub)
+	s.mu.Unlock()
+
+	if ok {
+		s.Metrics.clientLeft()
+	}
+}
+
+// Run tails the feed once for this API instance and fans each event out to
+// every subscription. It returns when ctx is cancelled.
+func (s *StreamService) Run(ctx context.Context) {
+	// Start at the end of the feed; cursor 0 would replay the whole stream to
+	// every subscriber, so keep trying until Redis answers.
+	var cursor int64
+	for {
+		_, newest, err := s.Volunteers.StreamBounds(ctx)
+		if err == nil {
+			cursor = newest
+			break
+		}
+		log.Println("stream hub: failed to read stream bounds:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+
+	for ctx.Err() == nil {
+		events, err := s.Next(ctx, cursor, streamHubWait)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Println("stream hub read error:", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		if len(events) == 0 {
+			// If the stream was reset underneath us, start again from its end.
+			if _, newest, err := s.Volunteers.StreamBounds(ctx); err == nil && newest < cursor {
+				cursor = newest
+			}
+			continue
+		}
+
+		s.mu.RLock()
+		subs := make([]*Subscription, 0, len(s.subs))
+		for sub := range s.subs {
+			subs = append(subs, sub)
+		}
+		s.mu.RUnlock()
+
+		for _, ev := range events {
+			cursor = ev.Seq
+			for _, sub := range subs {
+				if !sub.offer(ev) {
+					s.Unsubscribe(sub)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"reflect"
+	"testing"
+)
+
+func TestSubscriptionHold(t *testing.T) {
+	ev := func(seq int64) repositories.StreamEvent {
+		return repositories.StreamEvent{Seq: seq, Type: EventPosition, Data: []byte(`{"id":"v1"}`)}
+	}
+	snap := func(seq int64) repositories.StreamEvent {
+		return repositories.StreamEvent{Seq: seq, Type: EventSnapshot, Data: []byte(`[]`)}
+	}
+
+	tests := []struct {
+		name     string
+		held     []int64 // offered while the snapshot is taken
+		snapshot int64
+		want     []int64 // sequences delivered after it, in order
+	}{
+		{"nothing arrives", nil, 5, nil},
+		{"covered by the snapshot", []int64{4, 5}, 5, nil},
+		{"newer than the snapshot", []int64{6, 7}, 5, []int64{6, 7}},
+		{"straddling the snapshot", []int64{5, 6, 7}, 6, []int64{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []repositories.StreamEvent
+			sub := NewSubscription(nil, func(ev repositories.StreamEvent, _ bool) bool {
+				got = append(got, ev)
+				return true
+			})
+			if !sub.activate(0) || !sub.offer(ev(3)) {
+				t.Fatal("subscription closed")
+			}
+
+			sub.hold(nil)
+			for _, seq := range tt.held {
+				sub.offer(ev(seq))
+			}
+			if len(got) != 1 {
+				t.Fatalf("%d events delivered while held", len(got)-1)
+			}
+			sub.deliver(snap(tt.snapshot), true)
+			if !sub.activate(tt.snapshot) {
+				t.Fatal("subscription closed on activate")
+			}
+
+			if got[1].Type != EventSnapshot {
+				t.Fatalf("event after the hold is %q, want the snapshot", got[1].Type)
+			}
+			var after []int64
+			for _, e := range got[2:] {
+				after = append(after, e.Seq)
+			}
+			if !reflect.DeepEqual(after, tt.want) {
+				t.Errorf("delivered %v after the snapshot, want %v", after, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriptionHoldOverflow(t *testing.T) {
+	sub := NewSubscription(nil, func(repositories.StreamEvent, bool) bool { return true })
+	sub.activate(0)
+	sub.hold(nil)
+	for seq := int64(1); seq <= maxPendingEvent+1; seq++ {
+		sub.offer(repositories.StreamEvent{Seq: seq, Type: EventPosition})
+	}
+	if sub.activate(0) {
+		t.Error("activate succeeded after the held events overflowed")
+	}
+}
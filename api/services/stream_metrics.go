@@ -0,0 +1,65 @@
+package services
+
+import "sync/atomic"
+
+// StreamMetrics counts clients and message outcomes for one broadcast hub.
+// A nil *StreamMetrics is valid and records nothing.
+type StreamMetrics struct {
+	clients         atomic.Int64
+	delivered       atomic.Int64
+	dropped         atomic.Int64
+	slowDisconnects atomic.Int64
+}
+
+// StreamStats is a point-in-time copy of StreamMetrics.
+type StreamStats struct {
+	Clients         int64 `json:"clients"`
+	Delivered       int64 `json:"delivered"`
+	Dropped         int64 `json:"dropped"`
+	SlowDisconnects int64 `json:"slowDisconnects"`
+}
+
+func (m *StreamMetrics) clientJoined() {
+	if m != nil {
+		m.clients.Add(1)
+	}
+}
+
+func (m *StreamMetrics) clientLeft() {
+	if m != nil {
+		m.clients.Add(-1)
+	}
+}
+
+// Delivered records a message queued for a client.
+func (m *StreamMetrics) Delivered() {
+	if m != nil {
+		m.delivered.Add(1)
+	}
+}
+
+// Dropped records a message discarded because the client's queue was full.
+func (m *StreamMetrics) Dropped() {
+	if m != nil {
+		m.dropped.Add(1)
+	}
+}
+
+// SlowDisconnect records a client cut off for falling too far behind.
+func (m *StreamMetrics) SlowDisconnect() {
+	if m != nil {
+		m.slowDisconnects.Add(1)
+	}
+}
+
+func (m *StreamMetrics) Stats() StreamStats {
+	if m == nil {
+		return StreamStats{}
+	}
+	return StreamStats{
+		Clients:         m.clients.Load(),
+		Delivered:       m.delivered.Load(),
+		Dropped:         m.dropped.Load(),
+		SlowDisconnects: m.slowDisconnects.Load(),
+	}
+}
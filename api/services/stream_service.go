@@ -0,0 +1,198 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamService runs the admin live feed: one reader per API instance (see
+// Run) fanning out to every WebSocket and SSE client, each with its own filter.
+type StreamService struct {
+	Volunteers *repositories.VolunteerRepository
+	Areas      *repositories.AreaRepository
+	Presence   *PresenceService // optional; annotates snapshot positions
+	Metrics    StreamMetrics
+
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// SubscribeRequest is what a stream client sends to narrow its feed. Every
+// field is optional; the ones that are set must all match.
+type SubscribeRequest struct {
+	Action       string    `json:"action"`         // "subscribe" or "unsubscribe"
+	BBox         []float64 `json:"bbox,omitempty"` // minLng, minLat, maxLng, maxLat
+	AreaID       int       `json:"areaId,omitempty"`
+	VolunteerIDs []string  `json:"volunteerIds,omitempty"`
+}
+
+// StreamFilter is a resolved SubscribeRequest. The zero value matches everything.
+type StreamFilter struct {
+	bbox       []float64
+	area       [][][]float64
+	volunteers map[string]bool
+}
+
+// BuildFilter validates a subscribe request and loads anything it refers to.
+func (s *StreamService) BuildFilter(ctx context.Context, req SubscribeRequest) (*StreamFilter, error) {
+	f := &StreamFilter{}
+	if req.Action == "unsubscribe" {
+		return f, nil
+	}
+
+	if req.BBox != nil {
+		b := req.BBox
+		if len(b) != 4 || b[0] > b[2] || b[1] > b[3] {
+			return nil, invalidf("bbox must be [minLng, minLat, maxLng, maxLat]")
+		}
+		f.bbox = b
+	}
+
+	if req.AreaID != 0 {
+		area, err := s.Areas.GetArea(ctx, req.AreaID)
+		if err != nil {
+			return nil, err
+		}
+		_, rings, err := normalizePolygon(area.Polygon)
+		if err != nil {
+			return nil, err
+		}
+		f.area = rings
+	}
+
+	if len(req.VolunteerIDs) > 0 {
+		f.volunteers = make(map[string]bool, len(req.VolunteerIDs))
+		for _, id := range req.VolunteerIDs {
+			f.volunteers[strings.ToLower(strings.TrimSpace(id))] = true
+		}
+	}
+	return f, nil
+}
+
+// streamPayload is the common shape of everything on the admin stream:
+// positions carry "id", alerts carry "volunteerId".
+type streamPayload struct {
+	ID          json.RawMessage `json:"id"`
+	VolunteerID string          `json:"volunteerId"`
+	Lat         *float64        `json:"lat"`
+	Lng         *float64        `json:"lng"`
+}
+
+// Matches reports whether a raw stream payload passes the filter. Payloads
+// without coordinates pass the spatial criteria.
+func (f *StreamFilter) Matches(payload []byte) bool {
+	if f == nil || (f.bbox == nil && f.area == nil && f.volunteers == nil) {
+		return true
+	}
+
+	var p streamPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return false
+	}
+
+	if f.volunteers != nil {
+		id := p.VolunteerID
+		if id == "" {
+			json.Unmarshal(p.ID, &id)
+		}
+		if !f.volunteers[strings.ToLower(id)] {
+			return false
+		}
+	}
+
+	if p.Lat == nil || p.Lng == nil {
+		return true
+	}
+	lat, lng := *p.Lat, *p.Lng
+	if f.bbox != nil && (lng < f.bbox[0] || lat < f.bbox[1] || lng > f.bbox[2] || lat > f.bbox[3]) {
+		return false
+	}
+	if f.area != nil && !pointInPolygon(lng, lat, f.area) {
+		return false
+	}
+	return true
+}
+
+// MatchesEvent is Matches for a feed event. SOS events bypass every filter:
+// each admin must see an emergency whatever part of the map they watch.
+func (f *StreamFilter) MatchesEvent(ev repositories.StreamEvent) bool {
+	return strings.HasPrefix(ev.Type, "sos.") || f.Matches(ev.Data)
+}
+
+// Event types on the admin live feed, besides the geofence and presence ones.
+const (
+	EventPosition = "position"
+	EventSnapshot = "snapshot"
+)
+
+const (
+	MaxResumeEvents = 10000 // beyond this a reconnecting client gets a fresh snapshot
+	streamReadBatch = 100
+)
+
+// Snapshot returns the live positions matching the filter, tagged with the
+// newest sequence number at the time. Tailing the feed from that sequence
+// afterwards loses nothing; at worst an update is delivered twice.
+func (s *StreamService) Snapshot(ctx context.Context, f *StreamFilter) (repositories.StreamEvent, error) {
+	_, newest, err := s.Volunteers.StreamBounds(ctx)
+	if err != nil {
+		return repositories.StreamEvent{}, err
+	}
+	positions, err := s.Volunteers.GetLivePositions(ctx)
+	if err != nil {
+		return repositories.StreamEvent{}, err
+	}
+	if s.Presence != nil {
+		if recs, err := s.Presence.All(ctx); err == nil {
+			annotatePresence(positions, recs)
+		}
+	}
+
+	matching := make([]repositories.Position, 0, len(positions))
+	for _, p := range positions {
+		data, _ := json.Marshal(p)
+		if f.Matches(data) {
+			matching = append(matching, p)
+		}
+	}
+	data, err := json.Marshal(matching)
+	if err != nil {
+		return repositories.StreamEvent{}, err
+	}
+	return repositories.StreamEvent{Seq: newest, Type: EventSnapshot, Data: data}, nil
+}
+
+// Resume returns the events after since, or ok=false when they are no
+// longer all available and the client needs a snapshot instead.
+func (s *StreamService) Resume(ctx context.Context, since int64) (events []repositories.StreamEvent, ok bool, err error) {
+	oldest, newest, err := s.Volunteers.StreamBounds(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if since > newest || (oldest > 0 && since < oldest-1) || newest-since > MaxResumeEvents {
+		return nil, false, nil
+	}
+
+	cursor := since
+	for cursor < newest {
+		batch, err := s.Volunteers.ReadEvents(ctx, cursor, streamReadBatch*10, 0)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		events = append(events, batch...)
+		cursor = batch[len(batch)-1].Seq
+	}
+	return events, true, nil
+}
+
+// Next blocks until events after cursor arrive or wait elapses.
+func (s *StreamService) Next(ctx context.Context, cursor int64, wait time.Duration) ([]repositories.StreamEvent, error) {
+	return s.Volunteers.ReadEvents(ctx, cursor, streamReadBatch, wait)
+}
@@ -0,0 +1,499 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Turf cutting defaults and limits.
+const (
+	MaxTurfs             = 100
+	MaxTurfStops         = 5000  // stops a single cut will take on
+	DefaultDoorSeconds   = 120.0 // time spent at each door when balancing by time
+	DefaultTurfBuffer    = 25.0  // meters of padding around each turf hull
+	MaxTurfBuffer        = 500.0
+	turfBalanceTolerance = 0.1 // a turf may exceed its fair share by this fraction
+	turfIterations       = 50
+	turfNeighbors        = 6 // neighborhood size for the contiguity pass
+)
+
+// Balance modes for turf cutting.
+const (
+	BalanceDoors = "doors"
+	BalanceTime  = "time"
+)
+
+// TurfService cuts an area's stops into walk packets of similar size and
+// saves them as child areas.
+type TurfService struct {
+	Repo  *repositories.TurfRepository
+	Areas *repositories.AreaRepository
+	Stops *repositories.StopRepository
+}
+
+// TurfRequest configures a cut. Balance is "doors" (default) or "time";
+// Hull is "convex" (default) or "concave". DryRun returns the plan without
+// touching the area's existing turfs.
+type TurfRequest struct {
+	K            int      `json:"k"`
+	Balance      string   `json:"balance"`
+	Hull         string   `json:"hull"`
+	BufferMeters *float64 `json:"bufferMeters"`
+	NamePrefix   string   `json:"namePrefix"`
+	DryRun       bool     `json:"dryRun"`
+}
+
+type TurfPlan struct {
+	repositories.Turf
+	Doors            int     `json:"doors"`
+	WalkMeters       float64 `json:"walkMeters"`
+	EstimatedSeconds float64 `json:"estimatedSeconds"`
+}
+
+type TurfCut struct {
+	AreaID  int        `json:"areaId"`
+	Balance string     `json:"balance"`
+	DryRun  bool       `json:"dryRun"`
+	Turfs   []TurfPlan `json:"turfs"`
+}
+
+// Cut partitions the area's stops into req.K contiguous turfs of roughly
+// equal doors or estimated walking time, wraps each in a hull clipped to
+// the area, and unless req.DryRun replaces the area's existing turfs.
+func (s *TurfService) Cut(ctx context.Context, areaID int, req TurfRequest) (TurfCut, error) {
+	cut := TurfCut{AreaID: areaID, DryRun: req.DryRun, Turfs: []TurfPlan{}}
+	req.Balance = strings.ToLower(strings.TrimSpace(req.Balance))
+	if req.Balance == "" {
+		req.Balance = BalanceDoors
+	}
+	if req.Balance != BalanceDoors && req.Balance != BalanceTime {
+		return cut, invalidf("balance must be %q or %q", BalanceDoors, BalanceTime)
+	}
+	cut.Balance = req.Balance
+	req.Hull = strings.ToLower(strings.TrimSpace(req.Hull))
+	if req.Hull != "" && req.Hull != "convex" && req.Hull != "concave" {
+		return cut, invalidf("hull must be \"convex\" or \"concave\"")
+	}
+	buffer := DefaultTurfBuffer
+	if req.BufferMeters != nil {
+		buffer = *req.BufferMeters
+	}
+	// Some padding is needed: the hull of one or two stops has no area
+	if buffer < 1 || buffer > MaxTurfBuffer {
+		return cut, invalidf("bufferMeters must be between 1 and %g", MaxTurfBuffer)
+	}
+	if req.K < 2 || req.K > MaxTurfs {
+		return cut, invalidf("k must be between 2 and %d", MaxTurfs)
+	}
+
+	area, err := s.Areas.GetArea(ctx, areaID)
+	if err != nil {
+		return cut, err
+	}
+	if area.ParentID != nil {
+		return cut, invalidf("area %d is itself a turf; cut its parent instead", areaID)
+	}
+	all, err := s.Stops.ListStops(ctx, areaID)
+	if err != nil {
+		return cut, err
+	}
+	// Only the area's own stops; ListStops also returns a turf's packet
+	stops := all[:0]
+	for _, st := range all {
+		if st.AreaID == areaID {
+			stops = append(stops, st)
+		}
+	}
+	if len(stops) < req.K {
+		return cut, invalidf("area has %d stops, fewer than k=%d", len(stops), req.K)
+	}
+	if len(stops) > MaxTurfStops {
+		return cut, invalidf("area has %d stops, more than the %d a cut can take; split it first", len(stops), MaxTurfStops)
+	}
+
+	points := make([]RoutePoint, len(stops))
+	for i, st := range stops {
+		points[i] = RoutePoint{Lat: st.Lat, Lng: st.Lng}
+	}
+	labels := clusterStops(points, stopWeights(points, req.Balance), req.K)
+
+	groups := make([][]int, req.K)
+	for i, l := range labels {
+		groups[l] = append(groups[l], i)
+	}
+	// Number turfs west to east, then south to north, so names are stable-ish
+	sort.SliceStable(groups, func(a, b int) bool {
+		ca, cb := centroid(points, groups[a]), centroid(points, groups[b])
+		if math.Abs(ca.Lng-cb.Lng) > 1e-9 {
+			return ca.Lng < cb.Lng
+		}
+		return ca.Lat < cb.Lat
+	})
+
+	prefix := strings.TrimSpace(req.NamePrefix)
+	if prefix == "" {
+		prefix = area.Name
+	}
+	turfs := make([]repositories.Turf, 0, req.K)
+	for i, g := range groups {
+		t := repositories.Turf{Name: fmt.Sprintf("%s turf %d", prefix, i+1), StopIDs: make([]int, 0, len(g))}
+		pts := make([]RoutePoint, 0, len(g))
+		for _, idx := range g {
+			t.StopIDs = append(t.StopIDs, stops[idx].ID)
+			pts = append(pts, points[idx])
+		}
+		if t.Polygon, err = s.Repo.Hull(ctx, areaID, t.StopIDs, req.Hull == "concave", buffer); err != nil {
+			return cut, err
+		}
+		turfs = append(turfs, t)
+
+		walk := pathLength(pts, walkOrder(pts, false))
+		cut.Turfs = append(cut.Turfs, TurfPlan{
+			Doors:            len(g),
+			WalkMeters:       walk,
+			EstimatedSeconds: float64(len(g))*DefaultDoorSeconds + walk/WalkingSpeed,
+		})
+	}
+
+	if !req.DryRun {
+		if turfs, err = s.Repo.Replace(ctx, areaID, turfs); err != nil {
+			return cut, err
+		}
+	}
+	for i := range turfs {
+		cut.Turfs[i].Turf = turfs[i]
+	}
+	return cut, nil
+}
+
+// List returns the turfs previously cut from an area.
+func (s *TurfService) List(ctx context.Context, areaID int) ([]repositories.Turf, error) {
+	if _, err := s.Areas.GetArea(ctx, areaID); err != nil {
+		return nil, err
+	}
+	return s.Repo.List(ctx, areaID)
+}
+
+// stopWeights is the load each stop adds to a turf. Balancing by time adds
+// the walk to the nearest other stop to the time at the door, so sparse
+// stops count for more than doors in a dense block.
+func stopWeights(points []RoutePoint, balance string) []float64 {
+	w := make([]float64, len(points))
+	for i := range w {
+		w[i] = 1
+	}
+	if balance != BalanceTime {
+		return w
+	}
+	xy := projectLocal(points)
+	for i, nn := range nearestNeighbors(xy, 1) {
+		nearest := 0.0
+		if len(nn) > 0 {
+			nearest = math.Sqrt(planeDist2(xy[i], xy[nn[0]]))
+		}
+		w[i] = DefaultDoorSeconds + nearest/WalkingSpeed
+	}
+	return w
+}
+
+// projectLocal maps points to meters on an equirectangular projection
+// centered on their centroid, which is accurate enough at turf scale.
+func projectLocal(points []RoutePoint) [][2]float64 {
+	c := centroid(points, nil)
+	cosLat := math.Cos(c.Lat * math.Pi / 180)
+	xy := make([][2]float64, len(points))
+	for i, p := range points {
+		xy[i] = [2]float64{(p.Lng - c.Lng) * cosLat * metersPerDegree, (p.Lat - c.Lat) * metersPerDegree}
+	}
+	return xy
+}
+
+func planeDist2(a, b [2]float64) float64 {
+	dx, dy := a[0]-b[0], a[1]-b[1]
+	return dx*dx + dy*dy
+}
+
+// nearestNeighbors returns the m nearest other points of each point, nearest
+// first. Points are bucketed in a grid of about two per cell and each search
+// widens ring by ring until nothing closer can remain, so the cost stays
+// near O(n·m) instead of comparing every pair.
+func nearestNeighbors(xy [][2]float64, m int) [][]int {
+	n := len(xy)
+	out := make([][]int, n)
+	if m > n-1 {
+		m = n - 1
+	}
+	if m < 1 {
+		return out
+	}
+
+	minX, minY, maxX, maxY := xy[0][0], xy[0][1], xy[0][0], xy[0][1]
+	for _, p := range xy {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	w, h := maxX-minX, maxY-minY
+	cell := math.Sqrt(2 * w * h / float64(n))
+	if cell <= 0 {
+		// Collinear or coincident points
+		cell = 2 * math.Max(w, h) / float64(n)
+	}
+	if cell <= 0 {
+		cell = 1
+	}
+	cols, rows := int(w/cell)+1, int(h/cell)+1
+	cellOf := func(p [2]float64) (int, int) {
+		return int((p[0] - minX) / cell), int((p[1] - minY) / cell)
+	}
+	grid := make([][]int, cols*rows)
+	for i, p := range xy {
+		cx, cy := cellOf(p)
+		grid[cy*cols+cx] = append(grid[cy*cols+cx], i)
+	}
+
+	var cand []int
+	for i, p := range xy {
+		cand = cand[:0]
+		cx, cy := cellOf(p)
+		byDist := func(a, b int) bool { return planeDist2(p, xy[cand[a]]) < planeDist2(p, xy[cand[b]]) }
+		for r := 0; ; r++ {
+			for y := cy - r; y <= cy+r; y++ {
+				for x := cx - r; x <= cx+r; x++ {
+					onRing := y == cy-r || y == cy+r || x == cx-r || x == cx+r
+					if !onRing || x < 0 || y < 0 || x >= cols || y >= rows {
+						continue
+					}
+					for _, j := range grid[y*cols+x] {
+						if j != i {
+							cand = append(cand, j)
+						}
+					}
+				}
+			}
+			// Every point beyond ring r is at least r cells away
+			if len(cand) >= m {
+				sort.Slice(cand, byDist)
+				reach := float64(r) * cell
+				if planeDist2(p, xy[cand[m-1]]) <= reach*reach {
+					break
+				}
+			}
+			if r > cols && r > rows {
+				sort.Slice(cand, byDist)
+				break
+			}
+		}
+		out[i] = append([]int(nil), cand[:m]...)
+	}
+	return out
+}
+
+// clusterStops labels each point with one of k clusters using k-means with
+// a capacity on each cluster's total weight, then smooths the labels so
+// stragglers join the cluster that surrounds them. It works on a local
+// equirectangular projection in meters.
+func clusterStops(points []RoutePoint, weights []float64, k int) []int {
+	n := len(points)
+	xy := projectLocal(points)
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	capacity := total / float64(k) * (1 + turfBalanceTolerance)
+
+	// k-means++ seeding; a fixed seed keeps repeated cuts of the same stops identical
+	rng := rand.New(rand.NewSource(1))
+	centers := [][2]float64{xy[rng.Intn(n)]}
+	for len(centers) < k {
+		d := make([]float64, n)
+		sum := 0.0
+		for i, p := range xy {
+			d[i] = math.Inf(1)
+			for _, ctr := range centers {
+				d[i] = math.Min(d[i], planeDist2(p, ctr))
+			}
+			sum += d[i]
+		}
+		r := rng.Float64() * sum
+		next := n - 1
+		for i := range d {
+			if r -= d[i]; r <= 0 {
+				next = i
+				break
+			}
+		}
+		centers = append(centers, xy[next])
+	}
+
+	labels := make([]int, n)
+	for iter := 0; iter < turfIterations; iter++ {
+		// Capacitated assignment: points with the most to lose from not
+		// getting their nearest center choose first
+		type choice struct {
+			point  int
+			order  []int
+			regret float64
+		}
+		choices := make([]choice, n)
+		for i, p := range xy {
+			order := make([]int, k)
+			for j := range order {
+				order[j] = j
+			}
+			sort.Slice(order, func(a, b int) bool { return planeDist2(p, centers[order[a]]) < planeDist2(p, centers[order[b]]) })
+			regret := 0.0
+			if k > 1 {
+				regret = math.Sqrt(planeDist2(p, centers[order[1]])) - math.Sqrt(planeDist2(p, centers[order[0]]))
+			}
+			choices[i] = choice{i, order, regret}
+		}
+		sort.SliceStable(choices, func(a, b int) bool { return choices[a].regret > choices[b].regret })
+
+		load := make([]float64, k)
+		next := make([]int, n)
+		for _, ch := range choices {
+			label := ch.order[0]
+			for _, j := range ch.order {
+				if load[j]+weights[ch.point] <= capacity {
+					label = j
+					break
+				}
+			}
+			next[ch.point] = label
+			load[label] += weights[ch.point]
+		}
+
+		changed := iter == 0
+		for i := range labels {
+			if labels[i] != next[i] {
+				changed = true
+			}
+		}
+		labels = next
+		if !changed {
+			break
+		}
+
+		// Move each center to the weighted mean of its points
+		sums := make([][3]float64, k)
+		for i, l := range labels {
+			sums[l][0] += xy[i][0] * weights[i]
+			sums[l][1] += xy[i][1] * weights[i]
+			sums[l][2] += weights[i]
+		}
+		for j := range centers {
+			if sums[j][2] > 0 {
+				centers[j] = [2]float64{sums[j][0] / sums[j][2], sums[j][1] / sums[j][2]}
+			}
+		}
+	}
+
+	// A cluster can end up empty when capacity pushes its points elsewhere;
+	// seed it with the outermost point of the largest cluster
+	size := make([]int, k)
+	for _, l := range labels {
+		size[l]++
+	}
+	for j := range size {
+		if size[j] > 0 {
+			continue
+		}
+		largest := 0
+		for l := range size {
+			if size[l] > size[largest] {
+				largest = l
+			}
+		}
+		far, farD := -1, -1.0
+		for i, l := range labels {
+			if d := planeDist2(xy[i], centers[largest]); l == largest && d > farD {
+				far, farD = i, d
+			}
+		}
+		labels[far] = j
+		size[largest]--
+		size[j]++
+	}
+
+	smoothLabels(xy, weights, labels, k, capacity)
+	return labels
+}
+
+// smoothLabels moves a point to the cluster most of its nearest neighbors
+// belong to, as long as that keeps the target under capacity and does not
+// empty the source. This removes the islands the capacity constraint can
+// leave behind.
+func smoothLabels(xy [][2]float64, weights []float64, labels []int, k int, capacity float64) {
+	m := turfNeighbors
+	if m > len(xy)-1 {
+		m = len(xy) - 1
+	}
+	if m < 1 {
+		return
+	}
+	neighbors := nearestNeighbors(xy, m)
+
+	load := make([]float64, k)
+	size := make([]int, k)
+	for i, l := range labels {
+		load[l] += weights[i]
+		size[l]++
+	}
+	for pass := 0; pass < 5; pass++ {
+		moved := false
+		for i := range labels {
+			votes := make(map[int]int, m)
+			for _, j := range neighbors[i] {
+				votes[labels[j]]++
+			}
+			best, bestVotes := labels[i], votes[labels[i]]
+			for l, v := range votes {
+				if v > bestVotes {
+					best, bestVotes = l, v
+				}
+			}
+			if best == labels[i] || bestVotes*2 <= m || size[labels[i]] == 1 || load[best]+weights[i] > capacity {
+				continue
+			}
+			load[labels[i]] -= weights[i]
+			size[labels[i]]--
+			labels[i] = best
+			load[best] += weights[i]
+			size[best]++
+			moved = true
+		}
+		if !moved {
+			break
+		}
+	}
+}
+
+func centroid(points []RoutePoint, idx []int) RoutePoint {
+	var c RoutePoint
+	if idx == nil {
+		for _, p := range points {
+			c.Lat += p.Lat / float64(len(points))
+			c.Lng += p.Lng / float64(len(points))
+		}
+		return c
+	}
+	for _, i := range idx {
+		c.Lat += points[i].Lat / float64(len(idx))
+		c.Lng += points[i].Lng / float64(len(idx))
+	}
+	return c
+}
+
+func pathLength(points []RoutePoint, order []int) float64 {
+	d := 0.0
+	for i := 1; i < len(order); i++ {
+		a, b := points[order[i-1]], points[order[i]]
+		d += haversine(a.Lat, a.Lng, b.Lat, b.Lng)
+	}
+	return d
+}
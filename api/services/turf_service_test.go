@@ -0,0 +1,205 @@
+package services
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// blob scatters n points within about radius meters of (lat, lng).
+func blob(rng *rand.Rand, n int, lat, lng, radius float64) []RoutePoint {
+	pts := make([]RoutePoint, n)
+	for i := range pts {
+		pts[i] = RoutePoint{
+			Lat: lat + (rng.Float64()*2-1)*radius/metersPerDegree,
+			Lng: lng + (rng.Float64()*2-1)*radius/(metersPerDegree*math.Cos(lat*math.Pi/180)),
+		}
+	}
+	return pts
+}
+
+func TestClusterStops(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	twoBlobs := append(blob(rng, 40, 40.70, -73.95, 150), blob(rng, 40, 40.75, -73.90, 150)...)
+	threeBlobs := append(append(blob(rng, 30, 51.50, -0.12, 100), blob(rng, 30, 51.52, -0.12, 100)...), blob(rng, 30, 51.51, -0.08, 100)...)
+
+	tests := []struct {
+		name   string
+		points []RoutePoint
+		k      int
+		groups [][2]int // index ranges that must share a label
+	}{
+		{"two blobs", twoBlobs, 2, [][2]int{{0, 40}, {40, 80}}},
+		{"three blobs", threeBlobs, 3, [][2]int{{0, 30}, {30, 60}, {60, 90}}},
+		{"one stop per turf", blob(rng, 5, 40.7, -74, 500), 5, nil},
+		{"coincident stops", []RoutePoint{{1, 1}, {1, 1}, {1, 1}, {1, 1}}, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weights := stopWeights(tt.points, BalanceDoors)
+			labels := clusterStops(tt.points, weights, tt.k)
+			if len(labels) != len(tt.points) {
+				t.Fatalf("got %d labels for %d points", len(labels), len(tt.points))
+			}
+			size := make([]int, tt.k)
+			for _, l := range labels {
+				if l < 0 || l >= tt.k {
+					t.Fatalf("label %d out of range", l)
+				}
+				size[l]++
+			}
+			for l, n := range size {
+				if n == 0 {
+					t.Errorf("turf %d is empty", l)
+				}
+				if max := int(math.Ceil(float64(len(labels))/float64(tt.k)*(1+turfBalanceTolerance))) + 1; n > max {
+					t.Errorf("turf %d has %d stops, over the balanced maximum %d", l, n, max)
+				}
+			}
+			seen := map[int]bool{}
+			for _, g := range tt.groups {
+				l := labels[g[0]]
+				for i := g[0]; i < g[1]; i++ {
+					if labels[i] != l {
+						t.Fatalf("point %d split from its blob", i)
+					}
+				}
+				if seen[l] {
+					t.Errorf("two blobs share turf %d", l)
+				}
+				seen[l] = true
+			}
+
+			again := clusterStops(tt.points, weights, tt.k)
+			for i := range labels {
+				if labels[i] != again[i] {
+					t.Fatal("repeated cuts of the same stops differ")
+				}
+			}
+		})
+	}
+}
+
+func TestStopWeights(t *testing.T) {
+	// Three stops on a meridian: 100 m and 300 m apart
+	step := 100 / metersPerDegree
+	pts := []RoutePoint{{0, 0}, {step, 0}, {4 * step, 0}}
+
+	for _, w := range stopWeights(pts, BalanceDoors) {
+		if w != 1 {
+			t.Errorf("door weight = %g, want 1", w)
+		}
+	}
+	want := []float64{100, 100, 300}
+	for i, w := range stopWeights(pts, BalanceTime) {
+		walk := (w - DefaultDoorSeconds) * WalkingSpeed
+		if math.Abs(walk-want[i]) > 0.5 {
+			t.Errorf("stop %d: nearest walk %.1f m, want %g", i, walk, want[i])
+		}
+	}
+	if w := stopWeights(pts[:1], BalanceTime); w[0] != DefaultDoorSeconds {
+		t.Errorf("lone stop weight = %g, want %g", w[0], DefaultDoorSeconds)
+	}
+}
+
+func TestNearestNeighbors(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	random := func(n int, w, h float64) [][2]float64 {
+		xy := make([][2]float64, n)
+		for i := range xy {
+			xy[i] = [2]float64{rng.Float64() * w, rng.Float64() * h}
+		}
+		return xy
+	}
+	clustered := append(random(200, 50, 50), random(50, 5000, 5000)...)
+
+	tests := []struct {
+		name string
+		xy   [][2]float64
+		m    int
+	}{
+		{"single point", random(1, 10, 10), 6},
+		{"two points", random(2, 10, 10), 6},
+		{"random", random(500, 1000, 1000), 6},
+		{"wide strip", random(300, 10000, 5), 4},
+		{"collinear", random(100, 1000, 0), 6},
+		{"coincident", make([][2]float64, 20), 6},
+		{"dense core with outliers", clustered, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nearestNeighbors(tt.xy, tt.m)
+			m := tt.m
+			if m > len(tt.xy)-1 {
+				m = len(tt.xy) - 1
+			}
+			for i, p := range tt.xy {
+				others := make([]int, 0, len(tt.xy)-1)
+				for j := range tt.xy {
+					if j != i {
+						others = append(others, j)
+					}
+				}
+				sort.Slice(others, func(a, b int) bool { return planeDist2(p, tt.xy[others[a]]) < planeDist2(p, tt.xy[others[b]]) })
+
+				if len(got[i]) != m {
+					t.Fatalf("point %d: %d neighbors, want %d", i, len(got[i]), m)
+				}
+				for k, j := range got[i] {
+					if j == i {
+						t.Fatalf("point %d is its own neighbor", i)
+					}
+					if planeDist2(p, tt.xy[j]) != planeDist2(p, tt.xy[others[k]]) {
+						t.Fatalf("point %d: neighbor %d is not the %d-th nearest", i, j, k+1)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	step := 50 / metersPerDegree
+	line := []RoutePoint{{3 * step, 0}, {0, 0}, {4 * step, 0}, {step, 0}, {2 * step, 0}}
+	grid := make([]RoutePoint, 0, 16)
+	for i := 0; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			grid = append(grid, RoutePoint{float64(i) * step, float64(j) * step})
+		}
+	}
+
+	tests := []struct {
+		name       string
+		points     []RoutePoint
+		fixedStart bool
+		maxMeters  float64 // no longer than this
+	}{
+		{"empty", nil, false, 0},
+		{"single", line[:1], false, 0},
+		{"line sweeps end to end", line, false, 200.5},
+		{"line from a fixed start", line, true, 350.5},
+		{"grid snakes", grid, false, 750.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := walkOrder(tt.points, tt.fixedStart)
+			if len(order) != len(tt.points) {
+				t.Fatalf("order has %d stops, want %d", len(order), len(tt.points))
+			}
+			seen := make([]bool, len(tt.points))
+			for _, i := range order {
+				if i < 0 || i >= len(tt.points) || seen[i] {
+					t.Fatalf("order %v is not a permutation", order)
+				}
+				seen[i] = true
+			}
+			if tt.fixedStart && order[0] != 0 {
+				t.Errorf("fixed start moved to %d", order[0])
+			}
+			if d := pathLength(tt.points, order); d > tt.maxMeters {
+				t.Errorf("path is %.1f m, want at most %g", d, tt.maxMeters)
+			}
+		})
+	}
+}
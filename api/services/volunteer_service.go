@@ -3,54 +3,249 @@ package services
 import (
 	"altrinity/api/repositories"
 	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"math"
+	"sort"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 type VolunteerService struct {
-	Repo *repositories.VolunteerRepository // Wraps Postgres and Redis connections
+	Repo              *repositories.VolunteerRepository // Wraps Postgres and Redis connections
+	Geofence          *GeofenceService                  // Optional out-of-turf alerting
+	MaxAccuracyMeters float64                           // Fixes less accurate than this aren't persisted; 0 disables
+	MaxSpeed          float64                           // Implied speeds above this (m/s) are flagged; 0 disables
+	Settings          *SettingsService                  // Persistence thresholds and live TTL, per area
+	Presence          *PresenceService                  // Optional active/idle/stale/offline tracking
+	Shifts            *ShiftService                     // Shift lookups for RequireShift and shift-only sharing
+	RequireShift      bool                              // Reject fixes sent outside an open shift
+	Privacy           *PrivacyService                   // Optional per-volunteer sharing choices
+}
+
+// Position filtering defaults
+const (
+	DefaultMaxAccuracyMeters = 100.0 // Cell-tower and Wi-Fi guesses are usually worse
+	DefaultMaxSpeedKmh       = 200.0 // Faster than any canvasser travels between doors
+)
+
+// privacy returns the volunteer's sharing choices; without a PrivacyService
+// everyone shares normally.
+func (s *VolunteerService) privacy(ctx context.Context, volunteerID string) (repositories.PrivacySettings, error) {
+	if s.Privacy == nil {
+		return repositories.PrivacySettings{VolunteerID: volunteerID}, nil
+	}
+	return s.Privacy.Get(ctx, volunteerID)
+}
+
+// thresholds returns the settings in effect where the fix was taken.
+func (s *VolunteerService) thresholds(pos repositories.Position) PositionThresholds {
+	if s.Settings == nil {
+		return PositionThresholds{
+			MinDistanceMeters: DefaultMinDistanceMeters,
+			MinUpdateInterval: DefaultMinUpdateInterval,
+			LiveTTL:           DefaultLiveTTL,
+		}
+	}
+	return s.Settings.For(pos.Lat, pos.Lng)
 }
 
-// Position update threshold logic
+// Plausibility checks
 const (
-	MinDistanceMeters = 50.0            // Only persist if volunteer moved >50m
-	MinUpdateInterval = 5 * time.Minute // Or if last update >5 minutes ago
+	FlagImpliedSpeed   = "implied_speed" // jumped further than MaxSpeed allows since the previous fix
+	minJumpMeters      = 250.0           // jumps shorter than this are GPS jitter, never flagged
+	nullIslandDegrees  = 0.0001          // ~11 m around 0,0, where failed fixes land
+	suspectPositionTTL = 10 * time.Minute
 )
 
+// validatePosition rejects fixes that cannot be real: out-of-range or
+// null-island coordinates and out-of-range auxiliary readings.
+func validatePosition(pos repositories.Position) error {
+	if math.IsNaN(pos.Lat) || pos.Lat < -90 || pos.Lat > 90 {
+		return invalidf("lat must be between -90 and 90")
+	}
+	if math.IsNaN(pos.Lng) || pos.Lng < -180 || pos.Lng > 180 {
+		return invalidf("lng must be between -180 and 180")
+	}
+	if math.Abs(pos.Lat) < nullIslandDegrees && math.Abs(pos.Lng) < nullIslandDegrees {
+		return invalidf("position 0,0 is not a valid fix")
+	}
+	if pos.Accuracy != nil && *pos.Accuracy < 0 {
+		return invalidf("accuracy may not be negative")
+	}
+	if pos.Heading != nil && (*pos.Heading < 0 || *pos.Heading > 360) {
+		return invalidf("heading must be between 0 and 360")
+	}
+	if pos.Speed != nil && *pos.Speed < 0 {
+		return invalidf("speed may not be negative")
+	}
+	if pos.Battery != nil && (*pos.Battery < 0 || *pos.Battery > 1) {
+		return invalidf("battery must be between 0 and 1")
+	}
+	return nil
+}
+
+// fixTime is when the fix was taken: the device clock when supplied,
+// otherwise when the server received it.
+func fixTime(p repositories.Position) time.Time {
+	if p.DeviceTime != nil {
+		return *p.DeviceTime
+	}
+	return p.UpdatedAt
+}
+
+// implausible reports whether reaching curr from prev implies travelling
+// faster than MaxSpeed. slack is taken off the distance, for when prev was
+// snapped to a coarse grid.
+func (s *VolunteerService) implausible(curr, prev repositories.Position, slack float64) bool {
+	if s.MaxSpeed <= 0 || prev.ID == "" {
+		return false
+	}
+	distance := haversine(prev.Lat, prev.Lng, curr.Lat, curr.Lng) - slack
+	if distance <= minJumpMeters {
+		return false
+	}
+	elapsed := fixTime(curr).Sub(fixTime(prev)).Seconds()
+	if elapsed <= 0 {
+		return true
+	}
+	return distance/elapsed > s.MaxSpeed
+}
+
+// checkPlausible compares a raw fix with the live position. A fix that jumps
+// implausibly far is held as a suspect; a second fix consistent with the
+// suspect confirms the move (e.g. the volunteer drove to a new turf) and is
+// accepted. It returns the flag to record, or "" if the fix is accepted.
+// The live and suspect positions are stored coarsened when the volunteer
+// asked for that, so they are compared with a cell's worth of slack.
+func (s *VolunteerService) checkPlausible(ctx context.Context, pos repositories.Position, priv repositories.PrivacySettings) string {
+	slack := float64(priv.CoarseMeters)
+	live, err := s.Repo.GetLivePosition(ctx, pos.ID)
+	if err != nil || !s.implausible(pos, live, slack) {
+		return ""
+	}
+	if suspect, err := s.Repo.GetSuspectPosition(ctx, pos.ID); err == nil && !s.implausible(pos, suspect, slack) {
+		if err := s.Repo.ClearSuspectPosition(ctx, pos.ID); err != nil {
+			log.Println("clear suspect position error:", err)
+		}
+		return ""
+	}
+	if err := s.Repo.SetSuspectPosition(ctx, shared(pos, priv), suspectPositionTTL); err != nil {
+		log.Println("store suspect position error:", err)
+	}
+	return FlagImpliedSpeed
+}
+
+// UpdatePosition validates a fix, publishes it to the live map and persists
+// it when it passes the thresholds. With RequireShift, volunteers must be
+// checked in; a volunteer's privacy settings may drop or coarsen the fix.
+// Implausible jumps are stored flagged for review and neither broadcast nor
+// added to the volunteer's track.
 func (s *VolunteerService) UpdatePosition(ctx context.Context, pos repositories.Position) error {
-	// --- Store in Redis for live map ---
-	key := fmt.Sprintf("position:%s", pos.ID)
+	if err := validatePosition(pos); err != nil {
+		return err
+	}
+	if s.Shifts != nil && s.RequireShift {
+		if err := s.Shifts.RequireOpen(ctx, pos.ID); err != nil {
+			return err
+		}
+	}
 
-	payload, _ := json.Marshal(pos)
-	s.Repo.Redis.Set(ctx, key, string(payload), 10*time.Minute) // expire old ones
-	s.Repo.Redis.Publish(ctx, "positions", string(payload))
+	// --- Volunteer's sharing choices, before anything is stored ---
+	priv, err := s.privacy(ctx, pos.ID)
+	if err != nil {
+		return err
+	}
+	if priv.Paused {
+		return nil
+	}
+	if priv.ShiftOnly && s.Shifts != nil && !s.RequireShift {
+		if err := s.Shifts.RequireOpen(ctx, pos.ID); errors.Is(err, repositories.ErrNoOpenShift) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	// A live fix is stamped on arrival; a client-sent updatedAt could freeze
+	// the latest-position row or backdate history. A device time far from
+	// now would skew the speed check, so it is dropped. Offline fixes go
+	// through UploadBatch, which bounds their device time instead.
+	pos.UpdatedAt = time.Now().UTC()
+	if pos.DeviceTime != nil && pos.DeviceTime.Sub(pos.UpdatedAt).Abs() > MaxClockSkew {
+		pos.DeviceTime = nil
+	}
+
+	// Plausibility and the geofence judge the raw fix; only its shared form
+	// is published or stored.
+	if flag := s.checkPlausible(ctx, pos, priv); flag != "" {
+		return s.Repo.InsertFlaggedPosition(ctx, shared(pos, priv), flag)
+	}
+	s.publishLive(ctx, pos, priv)
+	pos = shared(pos, priv)
 
 	// --- Check last persisted position ---
 	last, err := s.Repo.GetLastPosition(ctx, pos.ID)
-	if err != nil && err != redis.Nil {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return err
 	}
 
-	if shouldPersist(pos, last) {
+	if s.shouldPersist(pos, last) {
 		return s.Repo.UpsertPosition(ctx, pos)
 	}
 	return nil
 }
 
-// shouldPersist returns true if user moved significantly or time expired
-func shouldPersist(curr, last repositories.Position) bool {
+// publishLive caches the position for the live map, appends it to the admin
+// feed, updates presence and runs the out-of-turf check. raw is the fix as
+// taken; everything but the turf check sees it as shared under priv.
+// Failures are logged, never returned.
+func (s *VolunteerService) publishLive(ctx context.Context, raw repositories.Position, priv repositories.PrivacySettings) {
+	pos := shared(raw, priv)
+
+	// --- Store in Redis for live map ---
+	key := fmt.Sprintf("position:%s", pos.ID)
+
+	payload, _ := json.Marshal(pos)
+	s.Repo.Redis.Set(ctx, key, string(payload), s.thresholds(pos).LiveTTL) // expire old ones
+
+	// --- Append to the admin live feed ---
+	if _, err := s.Repo.AppendEvent(ctx, EventPosition, pos); err != nil {
+		log.Println("position stream append error:", err)
+	}
+
+	// --- Presence ---
+	if s.Presence != nil {
+		if err := s.Presence.Touch(ctx, pos); err != nil {
+			log.Println("presence update error:", err)
+		}
+	}
+
+	// --- Out-of-turf check ---
+	if s.Geofence != nil {
+		if err := s.Geofence.Check(ctx, raw, pos); err != nil {
+			log.Println("geofence check error:", err)
+		}
+	}
+}
+
+// shouldPersist returns true if user moved significantly or time expired,
+// using the thresholds where curr was taken; fixes less accurate than
+// MaxAccuracyMeters are never persisted
+func (s *VolunteerService) shouldPersist(curr, last repositories.Position) bool {
+	if s.MaxAccuracyMeters > 0 && curr.Accuracy != nil && *curr.Accuracy > s.MaxAccuracyMeters {
+		return false
+	}
 	if last.ID == "" {
 		return true // first time
 	}
 
+	t := s.thresholds(curr)
 	distance := haversine(curr.Lat, curr.Lng, last.Lat, last.Lng)
-	timeDiff := time.Since(last.UpdatedAt)
+	timeDiff := curr.UpdatedAt.Sub(last.UpdatedAt)
 
-	return distance > MinDistanceMeters || timeDiff > MinUpdateInterval
+	return distance > t.MinDistanceMeters || timeDiff > t.MinUpdateInterval
 }
 
 // haversine formula to compute distance between two coords
@@ -66,6 +261,293 @@ func haversine(lat1, lon1, lat2, lon2 float64) float64 {
 	return R * c
 }
 
-func (s *VolunteerService) GetAllPositions(ctx context.Context) ([]repositories.Position, error) {
-	return s.Repo.GetAllPositions(ctx)
+// GetAllPositions returns every volunteer's latest stored position with their
+// presence and sharing mode. A non-empty statuses keeps only volunteers in
+// one of them.
+func (s *VolunteerService) GetAllPositions(ctx context.Context, statuses []string) ([]repositories.Position, error) {
+	positions, err := s.Repo.GetAllPositions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if s.Privacy != nil {
+		restricted, err := s.Privacy.ListRestricted(ctx)
+		if err != nil {
+			return nil, err
+		}
+		sharing := make(map[string][]string, len(restricted))
+		for _, p := range restricted {
+			sharing[p.VolunteerID] = p.Sharing()
+		}
+		for i := range positions {
+			positions[i].Sharing = sharing[positions[i].ID]
+		}
+	}
+	if s.Presence == nil {
+		return positions, nil
+	}
+	recs, err := s.Presence.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	annotatePresence(positions, recs)
+	if len(statuses) == 0 {
+		return positions, nil
+	}
+
+	want := make(map[string]bool, len(statuses))
+	for _, st := range statuses {
+		switch st {
+		case repositories.PresenceActive, repositories.PresenceIdle, repositories.PresenceStale, repositories.PresenceOffline:
+			want[st] = true
+		default:
+			return nil, invalidf("unknown status %q", st)
+		}
+	}
+	kept := positions[:0]
+	for _, p := range positions {
+		if want[p.Status] {
+			kept = append(kept, p)
+		}
+	}
+	return kept, nil
+}
+
+// ListFlagged returns fixes held for review; volunteerID is optional.
+func (s *VolunteerService) ListFlagged(ctx context.Context, volunteerID string, from, to time.Time) ([]repositories.FlaggedPosition, error) {
+	if volunteerID != "" {
+		id, err := normalizeVolunteerID(volunteerID)
+		if err != nil {
+			return nil, err
+		}
+		volunteerID = id
+	}
+	if !from.Before(to) {
+		return nil, invalidf("from must be before to")
+	}
+	if to.Sub(from) > MaxTrackWindow {
+		return nil, invalidf("time window may not exceed %s", MaxTrackWindow)
+	}
+	return s.Repo.ListFlaggedPositions(ctx, volunteerID, from, to)
+}
+
+// MaxTrackWindow bounds a single track request.
+const MaxTrackWindow = 31 * 24 * time.Hour
+
+// Track is a volunteer's breadcrumb trail as a GeoJSON Feature. Geometry is a
+// LineString (null when fewer than two fixes exist) and properties.timestamps
+// holds one entry per coordinate.
+type Track struct {
+	Type       string          `json:"type"`
+	Geometry   *TrackGeometry  `json:"geometry"`
+	Properties TrackProperties `json:"properties"`
+}
+
+type TrackGeometry struct {
+	Type        string       `json:"type"`
+	Coordinates [][2]float64 `json:"coordinates"`
+}
+
+type TrackProperties struct {
+	VolunteerID string      `json:"volunteerId"`
+	From        time.Time   `json:"from"`
+	To          time.Time   `json:"to"`
+	Timestamps  []time.Time `json:"timestamps"`
+}
+
+func (s *VolunteerService) GetTrack(ctx context.Context, volunteerID string, from, to time.Time) (Track, error) {
+	volunteerID, err := normalizeVolunteerID(volunteerID)
+	if err != nil {
+		return Track{}, err
+	}
+	if !from.Before(to) {
+		return Track{}, invalidf("from must be before to")
+	}
+	if to.Sub(from) > MaxTrackWindow {
+		return Track{}, invalidf("time window may not exceed %s", MaxTrackWindow)
+	}
+
+	points, err := s.Repo.GetTrack(ctx, volunteerID, from, to)
+	if err != nil {
+		return Track{}, err
+	}
+
+	track := Track{
+		Type: "Feature",
+		Properties: TrackProperties{
+			VolunteerID: volunteerID,
+			From:        from,
+			To:          to,
+			Timestamps:  make([]time.Time, 0, len(points)),
+		},
+	}
+	coords := make([][2]float64, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, [2]float64{p.Lng, p.Lat})
+		track.Properties.Timestamps = append(track.Properties.Timestamps, p.RecordedAt)
+	}
+	if len(coords) >= 2 {
+		track.Geometry = &TrackGeometry{Type: "LineString", Coordinates: coords}
+	}
+	return track, nil
+}
+
+// Batch upload limits
+const (
+	MaxBatchFixes = 1000
+	MaxFixAge     = 7 * 24 * time.Hour // older offline fixes are rejected
+	MaxClockSkew  = time.Minute        // tolerated device clock drift into the future
+)
+
+type BatchResult struct {
+	Received  int `json:"received"`
+	Rejected  int `json:"rejected"`  // invalid fixes or missing/implausible timestamps
+	Duplicate int `json:"duplicate"` // same timestamp as another fix
+	OffShift  int `json:"offShift"`  // taken outside any shift
+	Withheld  int `json:"withheld"`  // dropped because sharing is paused
+	Persisted int `json:"persisted"`
+	Flagged   int `json:"flagged"` // implausible jumps held for review
+}
+
+// UploadBatch stores a volunteer's queued fixes, subject to the same shift and
+// privacy rules as UpdatePosition. Fixes are de-duplicated by timestamp
+// (keeping the most accurate), ordered, thinned with shouldPersist and written
+// to history with their device timestamps. Only the newest fix is published
+// live, and only if it is newer than what the live map already has.
+func (s *VolunteerService) UploadBatch(ctx context.Context, volunteerID, fullName string, fixes []repositories.Position) (BatchResult, error) {
+	res := BatchResult{Received: len(fixes)}
+	if len(fixes) == 0 {
+		return res, invalidf("no fixes supplied")
+	}
+	if len(fixes) > MaxBatchFixes {
+		return res, invalidf("too many fixes: %d (max %d)", len(fixes), MaxBatchFixes)
+	}
+
+	priv, err := s.privacy(ctx, volunteerID)
+	if err != nil {
+		return res, err
+	}
+	if priv.Paused {
+		res.Withheld = len(fixes)
+		return res, nil
+	}
+
+	var ordered []repositories.Position
+	ordered, res.Rejected, res.Duplicate = dedupeFixes(fixes, volunteerID, fullName, time.Now().UTC())
+	if len(ordered) == 0 {
+		return res, nil
+	}
+
+	// Only fixes taken during a shift count, even one closed since.
+	if s.Shifts != nil && (s.RequireShift || priv.ShiftOnly) {
+		shifts, err := s.Shifts.During(ctx, volunteerID, ordered[0].UpdatedAt, ordered[len(ordered)-1].UpdatedAt)
+		if err != nil {
+			return res, err
+		}
+		onDuty := ordered[:0]
+		for _, p := range ordered {
+			if onShift(shifts, p.UpdatedAt) {
+				onDuty = append(onDuty, p)
+			}
+		}
+		res.OffShift = len(ordered) - len(onDuty)
+		if ordered = onDuty; len(ordered) == 0 {
+			return res, nil
+		}
+	}
+
+	// Thin against the last persisted fix only when the batch continues on
+	// from it; an older backlog starts its own trail segment.
+	last, err := s.Repo.GetLastPosition(ctx, volunteerID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return res, err
+	}
+	if last.UpdatedAt.After(ordered[0].UpdatedAt) {
+		last = repositories.Position{}
+	}
+
+	keep, flagged, newest := s.screenFixes(ordered, last, priv)
+	if len(keep) > 0 {
+		if err := s.Repo.UpsertPositions(ctx, keep); err != nil {
+			return res, err
+		}
+	}
+	for _, p := range flagged {
+		if err := s.Repo.InsertFlaggedPosition(ctx, p, FlagImpliedSpeed); err != nil {
+			return res, err
+		}
+	}
+	res.Persisted = len(keep)
+	res.Flagged = len(flagged)
+
+	if newest.ID == "" {
+		return res, nil
+	}
+	if live, err := s.Repo.GetLivePosition(ctx, volunteerID); err != nil || live.UpdatedAt.Before(newest.UpdatedAt) {
+		s.publishLive(ctx, newest, priv)
+	}
+	return res, nil
+}
+
+// dedupeFixes drops invalid, undated, future and stale fixes, keeps the most
+// accurate of fixes sharing a timestamp and returns the rest oldest first,
+// stamped with their device time.
+func dedupeFixes(fixes []repositories.Position, volunteerID, fullName string, now time.Time) (ordered []repositories.Position, rejected, duplicate int) {
+	byTime := make(map[int64]repositories.Position, len(fixes))
+	for _, f := range fixes {
+		if validatePosition(f) != nil || f.DeviceTime == nil ||
+			f.DeviceTime.After(now.Add(MaxClockSkew)) || now.Sub(*f.DeviceTime) > MaxFixAge {
+			rejected++
+			continue
+		}
+		key := f.DeviceTime.UnixMilli()
+		if prev, ok := byTime[key]; ok {
+			duplicate++
+			if !moreAccurate(f, prev) {
+				continue
+			}
+		}
+		f.ID, f.FullName = volunteerID, fullName
+		f.UpdatedAt = f.DeviceTime.UTC()
+		byTime[key] = f
+	}
+
+	ordered = make([]repositories.Position, 0, len(byTime))
+	for _, f := range byTime {
+		ordered = append(ordered, f)
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].UpdatedAt.Before(ordered[j].UpdatedAt) })
+	return ordered, rejected, duplicate
+}
+
+// screenFixes walks ordered fixes from last. Implausible jumps are flagged as
+// in UpdatePosition, judged on the raw fixes; a following fix consistent with
+// the flagged one confirms the move. Accepted fixes are thinned with
+// shouldPersist. keep and flagged hold the shared form; newest is the latest
+// accepted raw fix.
+func (s *VolunteerService) screenFixes(ordered []repositories.Position, last repositories.Position, priv repositories.PrivacySettings) (keep, flagged []repositories.Position, newest repositories.Position) {
+	slack := float64(priv.CoarseMeters)
+	var suspect repositories.Position
+	prev := last
+	for _, p := range ordered {
+		if s.implausible(p, prev, slack) && (suspect.ID == "" || s.implausible(p, suspect, slack)) {
+			flagged = append(flagged, shared(p, priv))
+			suspect = p
+			continue
+		}
+		suspect = repositories.Position{}
+		newest, prev = p, p
+		if p = shared(p, priv); s.shouldPersist(p, last) {
+			keep = append(keep, p)
+			last = p
+		}
+	}
+	return keep, flagged, newest
+}
+
+// moreAccurate prefers the fix with the smaller reported accuracy radius.
+func moreAccurate(a, b repositories.Position) bool {
+	if a.Accuracy == nil {
+		return false
+	}
+	return b.Accuracy == nil || *a.Accuracy < *b.Accuracy
 }
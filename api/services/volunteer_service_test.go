@@ -0,0 +1,267 @@
+package services
+
+import (
+	"altrinity/api/repositories"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+var testEpoch = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func ptr(v float64) *float64 { return &v }
+
+// fixAt is a fix north meters up the meridian from a point in Brooklyn,
+// taken sec seconds after testEpoch.
+func fixAt(north float64, sec int) repositories.Position {
+	t := testEpoch.Add(time.Duration(sec) * time.Second)
+	return repositories.Position{ID: "v1", Lat: 40.68 + north/metersPerDegree, Lng: -73.97, DeviceTime: &t, UpdatedAt: t}
+}
+
+func TestValidatePosition(t *testing.T) {
+	ok := fixAt(0, 0)
+	with := func(edit func(*repositories.Position)) repositories.Position {
+		p := ok
+		edit(&p)
+		return p
+	}
+	tests := []struct {
+		name  string
+		pos   repositories.Position
+		valid bool
+	}{
+		{"valid", ok, true},
+		{"valid readings", with(func(p *repositories.Position) {
+			p.Accuracy, p.Heading, p.Speed, p.Battery = ptr(0), ptr(360), ptr(0), ptr(1)
+		}), true},
+		{"lat out of range", with(func(p *repositories.Position) { p.Lat = 91 }), false},
+		{"lat NaN", with(func(p *repositories.Position) { p.Lat = math.NaN() }), false},
+		{"lng out of range", with(func(p *repositories.Position) { p.Lng = -181 }), false},
+		{"lng NaN", with(func(p *repositories.Position) { p.Lng = math.NaN() }), false},
+		{"null island", with(func(p *repositories.Position) { p.Lat, p.Lng = 0, 0.00005 }), false},
+		{"near null island", with(func(p *repositories.Position) { p.Lat, p.Lng = 0, 0.01 }), true},
+		{"negative accuracy", with(func(p *repositories.Position) { p.Accuracy = ptr(-1) }), false},
+		{"heading over 360", with(func(p *repositories.Position) { p.Heading = ptr(361) }), false},
+		{"negative speed", with(func(p *repositories.Position) { p.Speed = ptr(-0.1) }), false},
+		{"battery over 1", with(func(p *repositories.Position) { p.Battery = ptr(1.5) }), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePosition(tt.pos)
+			if (err == nil) != tt.valid {
+				t.Fatalf("validatePosition() = %v, want valid %v", err, tt.valid)
+			}
+			var verr *ValidationError
+			if err != nil && !errors.As(err, &verr) {
+				t.Errorf("error %v is not a validation error", err)
+			}
+		})
+	}
+}
+
+func TestImplausible(t *testing.T) {
+	s := &VolunteerService{MaxSpeed: 50}
+	withUpdatedAt := func(p repositories.Position, sec int) repositories.Position {
+		p.UpdatedAt = testEpoch.Add(time.Duration(sec) * time.Second)
+		return p
+	}
+
+	tests := []struct {
+		name       string
+		maxSpeed   float64
+		curr, prev repositories.Position
+		slack      float64
+		want       bool
+	}{
+		{"no previous fix", 50, fixAt(5000, 1), repositories.Position{}, 0, false},
+		{"check disabled", 0, fixAt(5000, 1), fixAt(0, 0), 0, false},
+		{"walking pace", 50, fixAt(100, 60), fixAt(0, 0), 0, false},
+		{"jitter under the jump floor", 50, fixAt(200, 0), fixAt(0, 0), 0, false},
+		{"driving pace", 50, fixAt(1000, 60), fixAt(0, 0), 0, false},
+		{"too fast", 50, fixAt(1000, 10), fixAt(0, 0), 0, true},
+		{"no time elapsed", 50, fixAt(1000, 0), fixAt(0, 0), 0, true},
+		{"out of order", 50, fixAt(1000, 0), fixAt(0, 30), 0, true},
+		{"coarse slack absorbs the jump", 50, fixAt(1200, 10), fixAt(0, 0), 1000, false},
+		{"coarse slack is not enough", 50, fixAt(2000, 10), fixAt(0, 0), 1000, true},
+		{"device time wins over arrival", 50, withUpdatedAt(fixAt(1000, 10), 600), fixAt(0, 0), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s.MaxSpeed = tt.maxSpeed
+			if got := s.implausible(tt.curr, tt.prev, tt.slack); got != tt.want {
+				t.Errorf("implausible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoreAccurate(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *float64
+		want bool
+	}{
+		{"smaller radius", ptr(5), ptr(20), true},
+		{"larger radius", ptr(20), ptr(5), false},
+		{"equal radius", ptr(5), ptr(5), false},
+		{"only a reports", ptr(50), nil, true},
+		{"only b reports", nil, ptr(50), false},
+		{"neither reports", nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := fixAt(0, 0), fixAt(0, 0)
+			a.Accuracy, b.Accuracy = tt.a, tt.b
+			if got := moreAccurate(a, b); got != tt.want {
+				t.Errorf("moreAccurate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDedupeFixes(t *testing.T) {
+	now := testEpoch.Add(time.Hour)
+	at := func(d time.Duration, acc *float64) repositories.Position {
+		p := fixAt(0, 0)
+		ts := now.Add(d)
+		p.ID, p.DeviceTime, p.UpdatedAt, p.Accuracy = "", &ts, time.Time{}, acc
+		return p
+	}
+	undated := at(0, nil)
+	undated.DeviceTime = nil
+	invalid := at(-time.Minute, nil)
+	invalid.Lat = 100
+	local := at(-3*time.Minute, nil)
+	zone := time.FixedZone("EST", -5*3600)
+	localTime := local.DeviceTime.In(zone)
+	local.DeviceTime = &localTime
+
+	tests := []struct {
+		name          string
+		fixes         []repositories.Position
+		want          []time.Duration // device times kept, relative to now
+		wantAccuracy  []float64       // 0 for none
+		rejected, dup int
+	}{
+		{"sorted oldest first",
+			[]repositories.Position{at(-time.Minute, nil), at(-3*time.Minute, nil), at(-2*time.Minute, nil)},
+			[]time.Duration{-3 * time.Minute, -2 * time.Minute, -time.Minute}, []float64{0, 0, 0}, 0, 0},
+		{"invalid and undated rejected",
+			[]repositories.Position{invalid, undated, at(-2*time.Minute, nil)},
+			[]time.Duration{-2 * time.Minute}, []float64{0}, 2, 0},
+		{"clock skew tolerated",
+			[]repositories.Position{at(30*time.Second, nil), at(2*time.Minute, nil)},
+			[]time.Duration{30 * time.Second}, []float64{0}, 1, 0},
+		{"too old rejected",
+			[]repositories.Position{at(-MaxFixAge-time.Second, nil), at(-MaxFixAge+time.Second, nil)},
+			[]time.Duration{-MaxFixAge + time.Second}, []float64{0}, 1, 0},
+		{"duplicate keeps the more accurate",
+			[]repositories.Position{at(-time.Minute, ptr(20)), at(-time.Minute, ptr(5)), at(-time.Minute, nil), at(-time.Minute, ptr(10))},
+			[]time.Duration{-time.Minute}, []float64{5}, 0, 3},
+		{"same millisecond is a duplicate",
+			[]repositories.Position{at(-time.Minute, nil), at(-time.Minute+100*time.Microsecond, ptr(8))},
+			[]time.Duration{-time.Minute + 100*time.Microsecond}, []float64{8}, 0, 1},
+		{"local device time stored as UTC",
+			[]repositories.Position{local},
+			[]time.Duration{-3 * time.Minute}, []float64{0}, 0, 0},
+		{"nothing usable",
+			[]repositories.Position{undated, invalid},
+			nil, nil, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, rejected, dup := dedupeFixes(tt.fixes, "v1", "Ada", now)
+			if rejected != tt.rejected || dup != tt.dup {
+				t.Errorf("rejected %d, duplicate %d; want %d, %d", rejected, dup, tt.rejected, tt.dup)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("kept %d fixes, want %d", len(got), len(tt.want))
+			}
+			for i, p := range got {
+				if p.ID != "v1" || p.FullName != "Ada" {
+					t.Errorf("fix %d belongs to %q %q", i, p.ID, p.FullName)
+				}
+				if !p.UpdatedAt.Equal(now.Add(tt.want[i])) || p.UpdatedAt.Location() != time.UTC {
+					t.Errorf("fix %d at %v, want %v UTC", i, p.UpdatedAt, now.Add(tt.want[i]))
+				}
+				acc := 0.0
+				if p.Accuracy != nil {
+					acc = *p.Accuracy
+				}
+				if acc != tt.wantAccuracy[i] {
+					t.Errorf("fix %d accuracy %g, want %g", i, acc, tt.wantAccuracy[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScreenFixes(t *testing.T) {
+	s := &VolunteerService{MaxSpeed: 50}
+	// 1.2 km north of a fix stored on a 1 km grid
+	coarseLast := coarsen(fixAt(0, -10), 1000)
+	pastCell := fixAt(0, 0)
+	pastCell.Lat, pastCell.Lng = coarseLast.Lat+1200/metersPerDegree, coarseLast.Lng
+
+	tests := []struct {
+		name    string
+		last    repositories.Position
+		fixes   []repositories.Position
+		coarse  int
+		keep    []int // indexes into fixes
+		flagged []int
+		newest  int // -1 if every fix was flagged
+	}{
+		{"walk persists each step", repositories.Position{},
+			[]repositories.Position{fixAt(0, 0), fixAt(100, 60), fixAt(200, 120)}, 0,
+			[]int{0, 1, 2}, nil, 2},
+		{"jitter thinned", repositories.Position{},
+			[]repositories.Position{fixAt(0, 0), fixAt(10, 60), fixAt(20, 120), fixAt(30, 400)}, 0,
+			[]int{0, 3}, nil, 3},
+		{"thinned against the last stored fix", fixAt(0, -60),
+			[]repositories.Position{fixAt(10, 0), fixAt(100, 60)}, 0,
+			[]int{1}, nil, 1},
+		{"spike flagged", repositories.Position{},
+			[]repositories.Position{fixAt(0, 0), fixAt(5000, 10), fixAt(20, 20), fixAt(120, 80)}, 0,
+			[]int{0, 3}, []int{1}, 3},
+		{"second fix confirms a move", repositories.Position{},
+			[]repositories.Position{fixAt(0, 0), fixAt(5000, 10), fixAt(5100, 70)}, 0,
+			[]int{0, 2}, []int{1}, 2},
+		{"scattered spikes all flagged", fixAt(0, -60),
+			[]repositories.Position{fixAt(5000, 0), fixAt(-5000, 10), fixAt(9000, 20)}, 0,
+			nil, []int{0, 1, 2}, -1},
+		{"coarse last fix gets slack", coarseLast,
+			[]repositories.Position{pastCell}, 1000,
+			[]int{0}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			priv := repositories.PrivacySettings{VolunteerID: "v1", CoarseMeters: tt.coarse}
+			keep, flagged, newest := s.screenFixes(tt.fixes, tt.last, priv)
+
+			same := func(what string, got []repositories.Position, want []int) {
+				if len(got) != len(want) {
+					t.Fatalf("%s %d fixes, want %d", what, len(got), len(want))
+				}
+				for i, p := range got {
+					if !p.UpdatedAt.Equal(tt.fixes[want[i]].UpdatedAt) {
+						t.Errorf("%s[%d] is from %v, want fix %d", what, i, p.UpdatedAt, want[i])
+					}
+					if tt.coarse > 0 && (p.Accuracy == nil || *p.Accuracy < float64(tt.coarse)) {
+						t.Errorf("%s[%d] stored at full precision", what, i)
+					}
+				}
+			}
+			same("kept", keep, tt.keep)
+			same("flagged", flagged, tt.flagged)
+
+			switch {
+			case tt.newest < 0 && newest.ID != "":
+				t.Errorf("newest = fix from %v, want none", newest.UpdatedAt)
+			case tt.newest >= 0 && (newest.UpdatedAt != tt.fixes[tt.newest].UpdatedAt || newest.Lat != tt.fixes[tt.newest].Lat):
+				t.Errorf("newest = raw fix from %v, want fix %d", newest.UpdatedAt, tt.newest)
+			}
+		})
+	}
+}
@@ -29,7 +29,149 @@ CREATE TABLE IF NOT EXISTS volunteer_positions
     "position" geography(Point,4326),
     updated_at timestamp without time zone DEFAULT now(),
     full_name text COLLATE pg_catalog."default",
-    CONSTRAINT volunteer_positions_pkey PRIMARY KEY (id),
     CONSTRAINT unique_volunteer_id UNIQUE (volunteer_id)
         INCLUDE(volunteer_id)
-)
+);
+
+-- Optional readings sent with a fix
+ALTER TABLE volunteer_positions ADD COLUMN IF NOT EXISTS accuracy DOUBLE PRECISION;
+ALTER TABLE volunteer_positions ADD COLUMN IF NOT EXISTS altitude DOUBLE PRECISION;
+ALTER TABLE volunteer_positions ADD COLUMN IF NOT EXISTS heading DOUBLE PRECISION;
+ALTER TABLE volunteer_positions ADD COLUMN IF NOT EXISTS speed DOUBLE PRECISION;
+ALTER TABLE volunteer_positions ADD COLUMN IF NOT EXISTS battery DOUBLE PRECISION;
+ALTER TABLE volunteer_positions ADD COLUMN IF NOT EXISTS device_time TIMESTAMPTZ;
+
+-- A stop is walked by one volunteer at a time
+CREATE UNIQUE INDEX IF NOT EXISTS assignments_stop_id_key ON assignments (stop_id);
+CREATE INDEX IF NOT EXISTS assignments_volunteer_id_idx ON assignments (volunteer_id);
+
+CREATE TABLE IF NOT EXISTS canvass_results (
+    id SERIAL PRIMARY KEY,
+    stop_id INT NOT NULL REFERENCES stops(id) ON DELETE CASCADE,
+    volunteer_id UUID NOT NULL,
+    outcome TEXT NOT NULL
+        CHECK (outcome IN ('not_home', 'refused', 'contacted', 'moved', 'inaccessible')),
+    notes TEXT,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+-- Tables created before recorded_at carried a zone held UTC wall times
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'canvass_results' AND column_name = 'recorded_at'
+                 AND data_type = 'timestamp without time zone') THEN
+        ALTER TABLE canvass_results ALTER COLUMN recorded_at TYPE timestamptz USING recorded_at AT TIME ZONE 'UTC';
+    END IF;
+END $$;
+CREATE INDEX IF NOT EXISTS canvass_results_stop_id_idx ON canvass_results (stop_id);
+CREATE INDEX IF NOT EXISTS canvass_results_volunteer_id_idx ON canvass_results (volunteer_id);
+
+-- Append-only breadcrumb trail; volunteer_positions only keeps the latest fix
+CREATE TABLE IF NOT EXISTS volunteer_position_history (
+    id BIGSERIAL PRIMARY KEY,
+    volunteer_id UUID NOT NULL,
+    "position" geography(Point,4326) NOT NULL,
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    accuracy DOUBLE PRECISION,
+    altitude DOUBLE PRECISION,
+    heading DOUBLE PRECISION,
+    speed DOUBLE PRECISION,
+    battery DOUBLE PRECISION,
+    device_time TIMESTAMPTZ,
+    flag TEXT -- set on implausible fixes held for review; these are excluded from tracks
+);
+CREATE INDEX IF NOT EXISTS volunteer_position_history_volunteer_time_idx
+    ON volunteer_position_history (volunteer_id, recorded_at);
+CREATE INDEX IF NOT EXISTS volunteer_position_history_flagged_idx
+    ON volunteer_position_history (recorded_at) WHERE flag IS NOT NULL;
+
+-- Out-of-turf warnings; an alert is open until cleared_at is set on re-entry
+CREATE TABLE IF NOT EXISTS geofence_alerts (
+    id SERIAL PRIMARY KEY,
+    volunteer_id UUID NOT NULL,
+    full_name TEXT,
+    area_id INT REFERENCES areas(id) ON DELETE SET NULL,
+    "position" geography(Point,4326) NOT NULL,
+    distance_meters DOUBLE PRECISION NOT NULL,
+    outside_since TIMESTAMPTZ NOT NULL,
+    raised_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    cleared_at TIMESTAMPTZ
+);
+CREATE UNIQUE INDEX IF NOT EXISTS geofence_alerts_open_key
+    ON geofence_alerts (volunteer_id) WHERE cleared_at IS NULL;
+
+-- Runtime position thresholds; the row with NULL area_id overrides the env
+-- defaults everywhere, area rows override it inside that area. NULL columns inherit.
+CREATE TABLE IF NOT EXISTS position_settings (
+    id SERIAL PRIMARY KEY,
+    area_id INT UNIQUE REFERENCES areas(id) ON DELETE CASCADE,
+    min_distance_meters DOUBLE PRECISION CHECK (min_distance_meters >= 0),
+    min_update_interval_seconds INT CHECK (min_update_interval_seconds >= 0),
+    live_ttl_seconds INT CHECK (live_ttl_seconds > 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS position_settings_global_key
+    ON position_settings ((area_id IS NULL)) WHERE area_id IS NULL;
+
+-- Volunteer shifts; positions are only accepted while one is open (ended_at IS NULL).
+-- distance_meters and doors_knocked are filled in at check-out.
+CREATE TABLE IF NOT EXISTS shifts (
+    id SERIAL PRIMARY KEY,
+    volunteer_id UUID NOT NULL,
+    full_name TEXT,
+    area_id INT REFERENCES areas(id) ON DELETE SET NULL,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    ended_at TIMESTAMPTZ,
+    distance_meters DOUBLE PRECISION,
+    doors_knocked INT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS shifts_open_key ON shifts (volunteer_id) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS shifts_volunteer_started_idx ON shifts (volunteer_id, started_at);
+
+-- Per-volunteer location sharing choices; no row means share normally
+CREATE TABLE IF NOT EXISTS volunteer_privacy (
+    volunteer_id UUID PRIMARY KEY,
+    full_name TEXT,
+    paused BOOLEAN NOT NULL DEFAULT false,
+    shift_only BOOLEAN NOT NULL DEFAULT false,
+    coarse_meters INT NOT NULL DEFAULT 0 CHECK (coarse_meters >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Volunteer emergencies; open until an admin acknowledges, then resolved.
+-- A volunteer has at most one unresolved incident; pressing SOS again re-raises it.
+CREATE TABLE IF NOT EXISTS sos_incidents (
+    id SERIAL PRIMARY KEY,
+    volunteer_id UUID NOT NULL,
+    full_name TEXT,
+    "position" geography(Point,4326),
+    accuracy DOUBLE PRECISION,
+    message TEXT,
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved')),
+    raised_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    acknowledged_at TIMESTAMPTZ,
+    acknowledged_by TEXT,
+    resolved_at TIMESTAMPTZ,
+    resolved_by TEXT,
+    last_broadcast_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE UNIQUE INDEX IF NOT EXISTS sos_incidents_unresolved_key
+    ON sos_incidents (volunteer_id) WHERE status <> 'resolved';
+CREATE INDEX IF NOT EXISTS sos_incidents_status_idx ON sos_incidents (status, last_broadcast_at);
+
+CREATE TABLE IF NOT EXISTS sos_notes (
+    id SERIAL PRIMARY KEY,
+    incident_id INT NOT NULL REFERENCES sos_incidents(id) ON DELETE CASCADE,
+    author_id TEXT NOT NULL,
+    author_name TEXT,
+    body TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE INDEX IF NOT EXISTS sos_notes_incident_id_idx ON sos_notes (incident_id);
+
+-- Turfs cut from an area are child areas; each stop remembers its turf so a
+-- turf can be assigned like any other area.
+ALTER TABLE areas ADD COLUMN IF NOT EXISTS parent_id INT REFERENCES areas(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS areas_parent_id_idx ON areas (parent_id);
+ALTER TABLE stops ADD COLUMN IF NOT EXISTS turf_id INT REFERENCES areas(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS stops_turf_id_idx ON stops (turf_id);